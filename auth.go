@@ -0,0 +1,369 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/gofiber/fiber/v2/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// AuthConfig defines the authentication of the metrics endpoint registered
+// by RegisterAt. Requests from outside AllowedCIDRs or without an allowed
+// client certificate are rejected with 403 Forbidden. If bearer tokens or
+// basic auth users are configured, requests must present one of them, or
+// are rejected with 401 Unauthorized.
+type AuthConfig struct {
+	// AllowedCIDRs lists the networks, or single IP addresses, allowed to
+	// scrape the endpoint. The client IP is taken from ctx.IP(), so set
+	// Fiber's ProxyHeader, EnableTrustedProxyCheck and TrustedProxies
+	// to use the client IP forwarded by a trusted proxy.
+	//
+	// Optional. Default: nil
+	AllowedCIDRs []string
+
+	// ClientCertCommonNames lists the subject common names of the TLS
+	// client certificates allowed to scrape the endpoint. The server must
+	// request and verify client certificates.
+	//
+	// Optional. Default: nil
+	ClientCertCommonNames []string
+
+	// BearerToken is the token expected in the "Authorization: Bearer"
+	// header.
+	//
+	// Optional. Default: ""
+	BearerToken string
+
+	// BearerTokenFile is read for the bearer token, instead of BearerToken.
+	// The file is read again when it changes.
+	//
+	// Optional. Default: ""
+	BearerTokenFile string
+
+	// BasicAuthUsers maps the users allowed with basic auth to their
+	// bcrypt password hash.
+	//
+	// Optional. Default: nil
+	BasicAuthUsers map[string]string
+
+	// HtpasswdFile is an htpasswd file of users allowed with basic auth,
+	// in addition to BasicAuthUsers. Only bcrypt hashes are supported.
+	// The file is read again when it changes.
+	//
+	// Optional. Default: ""
+	HtpasswdFile string
+
+	// Realm is sent in the WWW-Authenticate header of 401 responses.
+	//
+	// Optional. Default: "metrics"
+	Realm string
+}
+
+// authenticator checks the requests to the metrics endpoint.
+type authenticator struct {
+	prefixes       []netip.Prefix
+	commonNames    map[string]bool
+	bearerToken    string
+	tokenFile      *watchedFile[string]
+	users          map[string][]byte
+	htpasswd       *watchedFile[map[string][]byte]
+	bearerEnabled  bool
+	basicEnabled   bool
+	bearerResponse string
+	basicResponse  string
+}
+
+// newAuthHandler returns the handler authenticating scrapes, or nil if cfg
+// configures no authentication.
+func newAuthHandler(cfg *AuthConfig) (fiber.Handler, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	if cfg.BearerToken != "" && cfg.BearerTokenFile != "" {
+		return nil, errors.New("fiberprometheus: Auth.BearerToken and Auth.BearerTokenFile are mutually exclusive")
+	}
+
+	realm := cfg.Realm
+	if realm == "" {
+		realm = "metrics"
+	}
+	a := &authenticator{
+		bearerToken:    cfg.BearerToken,
+		bearerResponse: fmt.Sprintf("Bearer realm=%q", realm),
+		basicResponse:  fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", realm),
+	}
+
+	for _, cidr := range cfg.AllowedCIDRs {
+		prefix, err := parsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("fiberprometheus: invalid Auth.AllowedCIDRs entry %q: %w", cidr, err)
+		}
+		a.prefixes = append(a.prefixes, prefix)
+	}
+
+	if len(cfg.ClientCertCommonNames) > 0 {
+		a.commonNames = make(map[string]bool, len(cfg.ClientCertCommonNames))
+		for _, cn := range cfg.ClientCertCommonNames {
+			a.commonNames[cn] = true
+		}
+	}
+
+	if cfg.BearerTokenFile != "" {
+		tokenFile, err := newWatchedFile(cfg.BearerTokenFile, parseTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		a.tokenFile = tokenFile
+	}
+
+	if len(cfg.BasicAuthUsers) > 0 {
+		a.users = make(map[string][]byte, len(cfg.BasicAuthUsers))
+		for user, hash := range cfg.BasicAuthUsers {
+			if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+				return nil, fmt.Errorf("fiberprometheus: invalid bcrypt hash for Auth.BasicAuthUsers user %q: %w", user, err)
+			}
+			a.users[user] = []byte(hash)
+		}
+	}
+
+	if cfg.HtpasswdFile != "" {
+		htpasswd, err := newWatchedFile(cfg.HtpasswdFile, parseHtpasswd)
+		if err != nil {
+			return nil, err
+		}
+		a.htpasswd = htpasswd
+	}
+
+	a.bearerEnabled = a.bearerToken != "" || a.tokenFile != nil
+	a.basicEnabled = a.users != nil || a.htpasswd != nil
+	if len(a.prefixes) == 0 && a.commonNames == nil && !a.bearerEnabled && !a.basicEnabled {
+		return nil, nil
+	}
+	return a.handle, nil
+}
+
+// handle rejects requests which are not allowed to scrape the endpoint.
+func (a *authenticator) handle(ctx *fiber.Ctx) error {
+	if len(a.prefixes) > 0 && !a.ipAllowed(ctx.IP()) {
+		return ctx.SendStatus(fiber.StatusForbidden)
+	}
+	if a.commonNames != nil && !a.clientCertAllowed(ctx) {
+		return ctx.SendStatus(fiber.StatusForbidden)
+	}
+	if !a.bearerEnabled && !a.basicEnabled {
+		return ctx.Next()
+	}
+
+	auth := ctx.Get(fiber.HeaderAuthorization)
+	scheme, credentials, _ := strings.Cut(auth, " ")
+	switch {
+	case a.bearerEnabled && utils.EqualFold(scheme, "Bearer"):
+		if a.tokenAllowed(strings.TrimSpace(credentials)) {
+			return ctx.Next()
+		}
+	case a.basicEnabled && utils.EqualFold(scheme, "Basic"):
+		if a.basicAllowed(strings.TrimSpace(credentials)) {
+			return ctx.Next()
+		}
+	}
+
+	if a.bearerEnabled {
+		ctx.Response().Header.Add(fiber.HeaderWWWAuthenticate, a.bearerResponse)
+	}
+	if a.basicEnabled {
+		ctx.Response().Header.Add(fiber.HeaderWWWAuthenticate, a.basicResponse)
+	}
+	return ctx.SendStatus(fiber.StatusUnauthorized)
+}
+
+func (a *authenticator) ipAllowed(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range a.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *authenticator) clientCertAllowed(ctx *fiber.Ctx) bool {
+	state := ctx.Context().TLSConnectionState()
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return false
+	}
+	return a.commonNames[state.VerifiedChains[0][0].Subject.CommonName]
+}
+
+func (a *authenticator) tokenAllowed(token string) bool {
+	expected := a.bearerToken
+	if a.tokenFile != nil {
+		expected = a.tokenFile.get()
+	}
+	return expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+func (a *authenticator) basicAllowed(credentials string) bool {
+	raw, err := base64.StdEncoding.DecodeString(credentials)
+	if err != nil {
+		return false
+	}
+	user, password, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return false
+	}
+
+	hash, ok := a.users[user]
+	if !ok && a.htpasswd != nil {
+		hash, ok = a.htpasswd.get()[user]
+	}
+	if !ok {
+		// Take as long as for a known user, so that response times don't
+		// reveal which users exist
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+}
+
+// dummyHash is compared against the password of unknown users. It has the
+// cost of bcrypt.DefaultCost.
+var dummyHash = []byte("$2a$10$lSlJt9TrRGk0ZjveL54ARu5qXKb9g1GafFMiaDxikBohUnxmaJDVS")
+
+// parsePrefix parses a CIDR, or a single IP address as a full-length prefix.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func parseTokenFile(data []byte) (string, error) {
+	token := string(bytes.TrimSpace(data))
+	if token == "" {
+		return "", errors.New("empty bearer token")
+	}
+	return token, nil
+}
+
+// parseHtpasswd parses "user:hash" lines, ignoring blank lines and comments.
+func parseHtpasswd(data []byte) (map[string][]byte, error) {
+	users := make(map[string][]byte)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("line %d: expected user:hash", n)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("line %d: user %q: only bcrypt hashes are supported: %w", n, user, err)
+		}
+		users[user] = []byte(hash)
+	}
+	return users, scanner.Err()
+}
+
+// watchedFile holds the parsed content of a file, parsing it again when the
+// file's modification time or size change. If the changed file can't be
+// read or parsed, the last good content is kept.
+type watchedFile[T any] struct {
+	path  string
+	parse func([]byte) (T, error)
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	value   T
+}
+
+// newWatchedFile reads and parses the file, failing if it can't.
+func newWatchedFile[T any](path string, parse func([]byte) (T, error)) (*watchedFile[T], error) {
+	f := &watchedFile[T]{path: path, parse: parse}
+	info, err := os.Stat(path)
+	if err == nil {
+		err = f.load(info)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fiberprometheus: reading %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// get returns the content of the file, reloading it if it changed.
+func (f *watchedFile[T]) get() T {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		log.Errorf("fiberprometheus: reading %s: %v", f.path, err)
+		return f.value
+	}
+	if !info.ModTime().Equal(f.modTime) || info.Size() != f.size {
+		if err := f.load(info); err != nil {
+			log.Errorf("fiberprometheus: reading %s: %v", f.path, err)
+		}
+	}
+	return f.value
+}
+
+// load reads and parses the file, described by info. f.mu must be held
+// unless f isn't shared yet.
+func (f *watchedFile[T]) load(info os.FileInfo) error {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	value, err := f.parse(data)
+	if err != nil {
+		return err
+	}
+	f.modTime, f.size, f.value = info.ModTime(), info.Size(), value
+	return nil
+}
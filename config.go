@@ -0,0 +1,699 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Config defines the config for the FiberPrometheus middleware.
+type Config struct {
+	// Next defines a function to skip this middleware when returned true.
+	//
+	// Optional. Default: nil
+	Next func(c *fiber.Ctx) bool
+
+	// Registerer is where the collectors are registered. If it also
+	// implements prometheus.Gatherer it is used to serve the metrics endpoint.
+	//
+	// Optional. Default: prometheus.NewRegistry()
+	Registerer prometheus.Registerer
+
+	// Gatherer is used by RegisterAt to collect the metrics to expose.
+	//
+	// Optional. Default: Registerer if it is a prometheus.Gatherer,
+	// prometheus.DefaultGatherer otherwise
+	Gatherer prometheus.Gatherer
+
+	// ReuseExistingCollectors reuses the collectors already registered with
+	// the Registerer under the same name, labels and help, instead of
+	// failing with a prometheus.AlreadyRegisteredError. This allows several
+	// instances, e.g. for several Fiber apps, to share their metrics.
+	// Instances sharing a metric also share the tracking of its series for
+	// SeriesTTL and CardinalityLimit, and must set the same limit for it.
+	//
+	// Optional. Default: false
+	ReuseExistingCollectors bool
+
+	// HandlerOpts configures the handler registered by RegisterAt, e.g. its
+	// concurrency limit, timeout, compression and error handling. Errors are
+	// logged to ErrorLog, which defaults to Fiber's logger.
+	//
+	// Optional. Default: promhttp.HandlerOpts{EnableOpenMetrics: true}
+	HandlerOpts *promhttp.HandlerOpts
+
+	// Auth configures bearer token, basic auth, IP allow-list and TLS client
+	// certificate checks for the handler registered by RegisterAt.
+	//
+	// Optional. Default: nil
+	Auth *AuthConfig
+
+	// MeterProvider additionally records the requests through OpenTelemetry,
+	// following the HTTP semantic conventions: the http.server.request.duration
+	// histogram and the http.server.active_requests counter, with the
+	// http.request.method, url.scheme, http.route, http.response.status_code
+	// and error.type attributes, and the custom labels of
+	// request_duration_seconds. Const labels and the service name belong to
+	// the provider's resource instead.
+	//
+	// Optional. Default: nil
+	MeterProvider metric.MeterProvider
+
+	// DisablePrometheus records the requests only through MeterProvider,
+	// without registering any collector. SeriesTTL and the cardinality
+	// limits only apply to the Prometheus collectors.
+	//
+	// Optional. Default: false
+	DisablePrometheus bool
+
+	// ServiceName is added to all metrics as the "service" const label.
+	//
+	// Optional. Default: ""
+	ServiceName string
+
+	// Namespace is prefixed to all metric names.
+	//
+	// Optional. Default: ""
+	Namespace string
+
+	// Subsystem is prefixed to all metric names, after the Namespace.
+	//
+	// Optional. Default: ""
+	Subsystem string
+
+	// ConstLabels are added to all metrics.
+	//
+	// Optional. Default: nil
+	ConstLabels map[string]string
+
+	// AppLabel adds an "app" label holding the fiber.Config.AppName of the
+	// app serving the request, to tell apart several apps sharing one
+	// FiberPrometheus. Mounted sub-apps are served by their parent app,
+	// their routes are told apart by the mount prefix of the path instead.
+	//
+	// Optional. Default: false
+	AppLabel bool
+
+	// Naming selects the metric and standard label names, e.g. NamingOTel
+	// to share dashboards with services instrumented by otelhttp, or the
+	// NamingEcho, NamingGin and NamingPromhttp profiles to keep the metrics
+	// of another middleware when migrating to Fiber.
+	//
+	// Optional. Default: NamingDefault
+	Naming Naming
+
+	// Metrics renames, re-describes or disables individual metrics, e.g.
+	//
+	//	Metrics: map[fiberprometheus.Metric]fiberprometheus.MetricOpts{
+	//		fiberprometheus.MetricRequestsTotal:    {Name: "http_requests_total"},
+	//		fiberprometheus.MetricRequestsInFlight: {Disable: true},
+	//	}
+	//
+	// Optional. Default: nil
+	Metrics map[Metric]MetricOpts
+
+	// StatusCodeLabel renames the status code label, e.g. to "code".
+	//
+	// Optional. Default: the name given by the Naming, "status_code"
+	StatusCodeLabel string
+
+	// MethodLabel renames the method label.
+	//
+	// Optional. Default: the name given by the Naming, "method"
+	MethodLabel string
+
+	// PathLabel renames the route path label, e.g. to "route".
+	//
+	// Optional. Default: the name given by the Naming, "path"
+	PathLabel string
+
+	// ServerAddressLabel adds a "server_address" label holding the host
+	// name the request was sent to, without the port. The value comes from
+	// the client's Host header, so every distinct host creates new series;
+	// bound them with CardinalityLimit, or add a Label mapping the host to
+	// the names the server is configured for instead.
+	//
+	// Optional. Default: false
+	ServerAddressLabel bool
+
+	// URLSchemeLabel adds a "url_scheme" label holding "http" or "https".
+	//
+	// Optional. Default: false
+	URLSchemeLabel bool
+
+	// NetworkProtocolVersionLabel adds a "network_protocol_version" label
+	// holding the HTTP version of the request, e.g. "1.1", to the request
+	// metrics other than the in-flight gauge.
+	//
+	// Optional. Default: false
+	NetworkProtocolVersionLabel bool
+
+	// Labels are additional variable labels whose values are extracted from
+	// every request.
+	//
+	// Optional. Default: nil
+	Labels []Label
+
+	// SkipPaths is a list of route paths that are not recorded, matched
+	// exactly against the normalized route path.
+	//
+	// Optional. Default: nil
+	SkipPaths []string
+
+	// SkipPathPrefixes skips requests whose path starts with any of the
+	// prefixes. Like the other pattern rules below, it is matched against
+	// the request path, without trailing slash, before the handler chain
+	// runs.
+	//
+	// Optional. Default: nil
+	SkipPathPrefixes []string
+
+	// SkipPathGlobs skips requests whose path matches any of the patterns,
+	// using path.Match syntax. Note that "*" does not match "/".
+	//
+	// Optional. Default: nil
+	SkipPathGlobs []string
+
+	// SkipPathRegexps skips requests whose path matches any of the regular
+	// expressions.
+	//
+	// Optional. Default: nil
+	SkipPathRegexps []string
+
+	// SkipMethods skips requests with any of the methods, e.g. OPTIONS.
+	//
+	// Optional. Default: nil
+	SkipMethods []string
+
+	// SkipHeaders skips requests carrying a header whose value matches the
+	// regular expression, e.g. {"User-Agent": "^ELB-HealthChecker/"}.
+	//
+	// Optional. Default: nil
+	SkipHeaders map[string]string
+
+	// IgnoreStatusCodes is a list of status codes that are not recorded.
+	//
+	// Optional. Default: nil
+	IgnoreStatusCodes []int
+
+	// InitStatusCodes are the status codes for which the requests_total,
+	// request_duration_seconds and request_duration_summary_seconds series of
+	// every registered route are created with zero values, so they are
+	// exported before the route is first hit.
+	// Series are created when the middleware or the metrics endpoint first
+	// sees the app, when its routes change, or on InitRoutes. Metrics with
+	// custom labels or attribute labels such as URLSchemeLabel, HEAD routes
+	// and skipped routes are not initialized.
+	//
+	// Optional. Default: nil
+	InitStatusCodes []int
+
+	// SeriesTTL deletes the series of requests_total, the request duration
+	// metrics and the size histograms which have not been updated for longer
+	// than SeriesTTL, e.g. of deprecated routes or transient status codes.
+	// Deleted series are counted by series_evicted_total. Series created by
+	// InitStatusCodes only expire once they have been updated. Expiry runs
+	// in the background until Close is called.
+	//
+	// Optional. Default: 0, series never expire
+	SeriesTTL time.Duration
+
+	// SeriesExpiryInterval is how often series idle for longer than
+	// SeriesTTL are deleted.
+	//
+	// Optional. Default: SeriesTTL / 2, at least one millisecond
+	SeriesExpiryInterval time.Duration
+
+	// CardinalityLimit is the maximum number of series of each request
+	// metric. Once it is reached, observations of new label combinations are
+	// folded into a single overflow series whose variable labels are all
+	// "__overflow__", and counted by cardinality_limit_exceeded_total.
+	// Series deleted by SeriesTTL make room for new ones. Series created by
+	// InitStatusCodes don't count against the limit.
+	//
+	// Optional. Default: 0, unlimited
+	CardinalityLimit int
+
+	// CardinalityLimits overrides CardinalityLimit for individual metrics,
+	// 0 meaning unlimited.
+	//
+	// Optional. Default: nil
+	CardinalityLimits map[Metric]int
+
+	// HandleErrors calls the app's ErrorHandler for errors returned by the
+	// handler chain, like Fiber's logger middleware does, so the recorded
+	// status code and response size are exactly what the client receives.
+	// The error is not propagated to the handlers before this middleware.
+	//
+	// Optional. Default: false
+	HandleErrors bool
+
+	// ErrorStatus maps an error returned by the handler chain to the status
+	// code to record, e.g. to mirror a custom fiber.Config.ErrorHandler.
+	// Returning 0 falls back to the code of a, possibly wrapped, *fiber.Error
+	// or 500. Not used when HandleErrors is set.
+	//
+	// Optional. Default: nil
+	ErrorStatus func(c *fiber.Ctx, err error) int
+
+	// RecordUnmatchedRoutes records requests that did not match any
+	// registered route, such as 404s and 405s, under UnmatchedRoutePath
+	// instead of dropping them. The fixed path keeps the cardinality bounded.
+	//
+	// Optional. Default: false
+	RecordUnmatchedRoutes bool
+
+	// UnmatchedRoutePath is the path label value of unmatched requests.
+	//
+	// Optional. Default: "<unmatched>"
+	UnmatchedRoutePath string
+
+	// Buckets are the upper bounds of the classic request_duration_seconds
+	// histogram buckets, see DefaultBuckets, PrometheusDefaultBuckets,
+	// WebLatencyBuckets and ExponentialBuckets.
+	//
+	// Optional. Default: DefaultBuckets, or the buckets of the Naming profile
+	Buckets []float64
+
+	// NativeHistogramBucketFactor enables the native (sparse) histogram
+	// representation of request_duration_seconds when greater than one.
+	// See prometheus.HistogramOpts for details.
+	//
+	// Optional. Default: 0 (native histograms disabled)
+	NativeHistogramBucketFactor float64
+
+	// NativeHistogramMaxBucketNumber limits the number of native histogram
+	// buckets. Zero means no limit.
+	//
+	// Optional. Default: 0
+	NativeHistogramMaxBucketNumber uint32
+
+	// NativeHistogramMinResetDuration is the minimum time between resets of
+	// a native histogram that exceeds NativeHistogramMaxBucketNumber.
+	//
+	// Optional. Default: 0
+	NativeHistogramMinResetDuration time.Duration
+
+	// DisableClassicBuckets exposes request_duration_seconds as a native
+	// histogram only. Requires NativeHistogramBucketFactor.
+	//
+	// Optional. Default: false
+	DisableClassicBuckets bool
+
+	// EnableRequestSize registers the request_size_bytes histogram, which
+	// observes the size of the request headers and body.
+	//
+	// Optional. Default: false
+	EnableRequestSize bool
+
+	// RequestSizeBuckets are the upper bounds of the request_size_bytes
+	// histogram buckets.
+	//
+	// Optional. Default: DefaultSizeBuckets, or the buckets of the Naming
+	// profile
+	RequestSizeBuckets []float64
+
+	// EnableResponseSize registers the response_size_bytes histogram, which
+	// observes the size of the response body. Streamed bodies are observed by
+	// their Content-Length, chunked ones are not observed.
+	//
+	// Optional. Default: false
+	EnableResponseSize bool
+
+	// ResponseSizeBuckets are the upper bounds of the response_size_bytes
+	// histogram buckets.
+	//
+	// Optional. Default: DefaultSizeBuckets, or the buckets of the Naming
+	// profile
+	ResponseSizeBuckets []float64
+
+	// EnableDurationSummary registers the request_duration_summary_seconds
+	// summary, which observes the same durations as
+	// request_duration_seconds but exports pre-computed quantiles. To use it
+	// instead of the histogram, disable MetricRequestDuration and rename
+	// MetricRequestDurationSummary to "request_duration_seconds" in Metrics.
+	// Summaries carry no exemplars.
+	//
+	// Optional. Default: false
+	EnableDurationSummary bool
+
+	// SummaryObjectives maps the quantiles of the summary to their allowed
+	// absolute error. An empty map exports the sum and count only.
+	//
+	// Optional. Default: DefaultObjectives
+	SummaryObjectives map[float64]float64
+
+	// SummaryMaxAge is how long observations are taken into account by the
+	// quantiles.
+	//
+	// Optional. Default: prometheus.DefMaxAge (10 minutes)
+	SummaryMaxAge time.Duration
+
+	// SummaryAgeBuckets is the number of buckets the SummaryMaxAge window is
+	// divided into, the quantiles slide by SummaryMaxAge/SummaryAgeBuckets.
+	//
+	// Optional. Default: prometheus.DefAgeBuckets (5)
+	SummaryAgeBuckets uint32
+}
+
+// DefaultBuckets are the request_duration_seconds buckets used when
+// Config.Buckets is not set, ranging from 1ns to 60s. Most of them are below
+// what an HTTP handler ever takes, prefer a coarser layout where series count
+// matters.
+var DefaultBuckets = []float64{
+	0.000000001, // 1ns
+	0.000000002,
+	0.000000005,
+	0.00000001, // 10ns
+	0.00000002,
+	0.00000005,
+	0.0000001, // 100ns
+	0.0000002,
+	0.0000005,
+	0.000001, // 1µs
+	0.000002,
+	0.000005,
+	0.00001, // 10µs
+	0.00002,
+	0.00005,
+	0.0001, // 100µs
+	0.0002,
+	0.0005,
+	0.001, // 1ms
+	0.002,
+	0.005,
+	0.01, // 10ms
+	0.02,
+	0.05,
+	0.1, // 100 ms
+	0.2,
+	0.5,
+	1.0, // 1s
+	2.0,
+	5.0,
+	10.0, // 10s
+	15.0,
+	20.0,
+	30.0,
+	60.0, // 1m
+}
+
+// PrometheusDefaultBuckets are the default buckets of the Prometheus client,
+// ranging from 5ms to 10s.
+var PrometheusDefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// WebLatencyBuckets are tuned for typical web handlers, ranging from 1ms to
+// 60s.
+var WebLatencyBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// ExponentialBuckets returns count buckets, where the lowest bucket has an
+// upper bound of start and each following bucket's upper bound is factor
+// times the previous one. It panics on invalid arguments, just like
+// prometheus.ExponentialBuckets.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	return prometheus.ExponentialBuckets(start, factor, count)
+}
+
+// DefaultSizeBuckets are the request_size_bytes and response_size_bytes
+// buckets used when none are configured, ranging from 256B to 16MiB.
+var DefaultSizeBuckets = []float64{256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304, 16777216}
+
+// DefaultObjectives are the request_duration_summary_seconds quantiles used
+// when none are configured: the median, 90th and 99th percentiles.
+var DefaultObjectives = map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}
+
+// ConfigDefault is the default config
+var ConfigDefault = Config{
+	Next:                nil,
+	UnmatchedRoutePath:  "<unmatched>",
+	Buckets:             DefaultBuckets,
+	RequestSizeBuckets:  DefaultSizeBuckets,
+	ResponseSizeBuckets: DefaultSizeBuckets,
+	SummaryObjectives:   DefaultObjectives,
+}
+
+// Helper function to set default values
+func configDefault(cfg Config) Config {
+	if cfg.Registerer == nil {
+		cfg.Registerer = prometheus.NewRegistry()
+	}
+	if cfg.Gatherer == nil {
+		// If the registerer is also a gatherer, use it, falling back to the
+		// DefaultGatherer.
+		gatherer, ok := cfg.Registerer.(prometheus.Gatherer)
+		if !ok {
+			gatherer = prometheus.DefaultGatherer
+		}
+		cfg.Gatherer = gatherer
+	}
+	if cfg.HandlerOpts == nil {
+		cfg.HandlerOpts = &promhttp.HandlerOpts{EnableOpenMetrics: true}
+	}
+	if cfg.SeriesExpiryInterval == 0 && cfg.SeriesTTL > 0 {
+		cfg.SeriesExpiryInterval = max(cfg.SeriesTTL/2, minSeriesExpiryInterval)
+	}
+	if cfg.UnmatchedRoutePath == "" {
+		cfg.UnmatchedRoutePath = ConfigDefault.UnmatchedRoutePath
+	}
+	// Naming profiles come with the buckets of the middleware they mimic
+	names := cfg.Naming.names()
+	if cfg.Buckets == nil {
+		cfg.Buckets = ConfigDefault.Buckets
+		if names.buckets != nil {
+			cfg.Buckets = names.buckets
+		}
+	}
+	if cfg.RequestSizeBuckets == nil {
+		cfg.RequestSizeBuckets = ConfigDefault.RequestSizeBuckets
+		if names.sizeBuckets != nil {
+			cfg.RequestSizeBuckets = names.sizeBuckets
+		}
+	}
+	if cfg.ResponseSizeBuckets == nil {
+		cfg.ResponseSizeBuckets = ConfigDefault.ResponseSizeBuckets
+		if names.sizeBuckets != nil {
+			cfg.ResponseSizeBuckets = names.sizeBuckets
+		}
+	}
+	if cfg.SummaryObjectives == nil {
+		cfg.SummaryObjectives = ConfigDefault.SummaryObjectives
+	}
+	return cfg
+}
+
+// enabled reports whether metric m is registered.
+func (cfg Config) enabled(m Metric) bool {
+	switch {
+	case cfg.Metrics[m].Disable:
+		return false
+	case m == MetricRequestSize:
+		return cfg.EnableRequestSize
+	case m == MetricResponseSize:
+		return cfg.EnableResponseSize
+	case m == MetricRequestDurationSummary:
+		return cfg.EnableDurationSummary
+	default:
+		return true
+	}
+}
+
+// validate checks the config for values that would make the collectors
+// panic on registration or produce invalid metrics.
+func (cfg Config) validate() error {
+	if cfg.DisablePrometheus && cfg.MeterProvider == nil {
+		return fmt.Errorf("fiberprometheus: DisablePrometheus requires MeterProvider")
+	}
+
+	if cfg.Naming < NamingDefault || cfg.Naming > NamingPromhttp {
+		return fmt.Errorf("fiberprometheus: unknown Naming %d", cfg.Naming)
+	}
+
+	if name := prometheus.BuildFQName(cfg.Namespace, cfg.Subsystem, cfg.Naming.names().metrics[MetricRequestsTotal]); !model.IsValidLegacyMetricName(name) {
+		return fmt.Errorf("fiberprometheus: invalid namespace %q or subsystem %q", cfg.Namespace, cfg.Subsystem)
+	}
+
+	for m := range cfg.Metrics {
+		if m < MetricRequestsTotal || m > MetricRequestDurationSummary {
+			return fmt.Errorf("fiberprometheus: unknown metric %v in Metrics", m)
+		}
+	}
+	names := cfg.names()
+
+	// Renamed metrics must be valid and must not collide with each other
+	named := make(map[string]Metric)
+	for _, m := range allMetrics {
+		if !cfg.enabled(m) {
+			continue
+		}
+		name := prometheus.BuildFQName(cfg.Namespace, cfg.Subsystem, names.metrics[m])
+		if !model.IsValidLegacyMetricName(name) {
+			return fmt.Errorf("fiberprometheus: invalid name %q for %v", cfg.Metrics[m].Name, m)
+		}
+		if other, ok := named[name]; ok {
+			return fmt.Errorf("fiberprometheus: %v and %v are both named %q", other, m, name)
+		}
+		named[name] = m
+	}
+
+	// Custom labels must not collide with the variable and const labels
+	reserved := make(map[string]bool)
+	for _, label := range []string{names.status, names.method, names.path} {
+		if !model.LabelName(label).IsValidLegacy() || strings.HasPrefix(label, model.ReservedLabelPrefix) {
+			return fmt.Errorf("fiberprometheus: invalid label name %q", label)
+		}
+		if reserved[label] {
+			return fmt.Errorf("fiberprometheus: duplicate label %q", label)
+		}
+		reserved[label] = true
+	}
+	for _, l := range attributeLabels(cfg) {
+		if reserved[l.name] {
+			return fmt.Errorf("fiberprometheus: label %q collides with an existing label", l.name)
+		}
+		reserved[l.name] = true
+	}
+	if cfg.AppLabel && reserved["app"] {
+		return fmt.Errorf("fiberprometheus: label %q collides with AppLabel", "app")
+	}
+
+	for label := range cfg.ConstLabels {
+		if !model.LabelName(label).IsValidLegacy() {
+			return fmt.Errorf("fiberprometheus: invalid const label name %q", label)
+		}
+		if reserved[label] {
+			return fmt.Errorf("fiberprometheus: const label %q collides with a variable label", label)
+		}
+		switch label {
+		case "app":
+			if cfg.AppLabel {
+				return fmt.Errorf("fiberprometheus: const label %q collides with AppLabel", label)
+			}
+		case "service":
+			if cfg.ServiceName != "" {
+				return fmt.Errorf("fiberprometheus: const label %q collides with ServiceName", label)
+			}
+		}
+	}
+
+	if cfg.ServiceName != "" {
+		reserved["service"] = true
+	}
+	if cfg.AppLabel {
+		reserved["app"] = true
+	}
+	for label := range cfg.ConstLabels {
+		reserved[label] = true
+	}
+	if err := validateLabels(cfg.Labels, reserved); err != nil {
+		return err
+	}
+
+	for _, code := range cfg.IgnoreStatusCodes {
+		if code < 100 || code > 999 {
+			return fmt.Errorf("fiberprometheus: invalid status code %d in IgnoreStatusCodes", code)
+		}
+	}
+	if cfg.SeriesTTL < 0 {
+		return fmt.Errorf("fiberprometheus: SeriesTTL must not be negative, got %v", cfg.SeriesTTL)
+	}
+	if cfg.SeriesExpiryInterval < 0 {
+		return fmt.Errorf("fiberprometheus: SeriesExpiryInterval must not be negative, got %v", cfg.SeriesExpiryInterval)
+	}
+
+	if cfg.CardinalityLimit < 0 {
+		return fmt.Errorf("fiberprometheus: CardinalityLimit must not be negative, got %d", cfg.CardinalityLimit)
+	}
+	for m, limit := range cfg.CardinalityLimits {
+		if m < MetricRequestsTotal || m > MetricRequestDurationSummary {
+			return fmt.Errorf("fiberprometheus: unknown metric %v in CardinalityLimits", m)
+		}
+		if limit < 0 {
+			return fmt.Errorf("fiberprometheus: CardinalityLimits of %v must not be negative, got %d", m, limit)
+		}
+	}
+
+	for _, code := range cfg.InitStatusCodes {
+		if code < 100 || code > 999 {
+			return fmt.Errorf("fiberprometheus: invalid status code %d in InitStatusCodes", code)
+		}
+	}
+
+	if err := validateBuckets(cfg.Buckets); err != nil {
+		return fmt.Errorf("fiberprometheus: request_duration_seconds: %w", err)
+	}
+
+	if err := validateBuckets(cfg.RequestSizeBuckets); err != nil {
+		return fmt.Errorf("fiberprometheus: request_size_bytes: %w", err)
+	}
+	if err := validateBuckets(cfg.ResponseSizeBuckets); err != nil {
+		return fmt.Errorf("fiberprometheus: response_size_bytes: %w", err)
+	}
+
+	for q, e := range cfg.SummaryObjectives {
+		if q < 0 || q > 1 {
+			return fmt.Errorf("fiberprometheus: invalid quantile %v in SummaryObjectives", q)
+		}
+		if e < 0 || e > 1 {
+			return fmt.Errorf("fiberprometheus: invalid error %v of quantile %v in SummaryObjectives", e, q)
+		}
+	}
+	if cfg.SummaryMaxAge < 0 {
+		return fmt.Errorf("fiberprometheus: SummaryMaxAge must not be negative, got %v", cfg.SummaryMaxAge)
+	}
+
+	if cfg.HandlerOpts.MaxRequestsInFlight < 0 {
+		return fmt.Errorf("fiberprometheus: HandlerOpts.MaxRequestsInFlight must not be negative, got %d", cfg.HandlerOpts.MaxRequestsInFlight)
+	}
+	if cfg.HandlerOpts.Timeout < 0 {
+		return fmt.Errorf("fiberprometheus: HandlerOpts.Timeout must not be negative, got %v", cfg.HandlerOpts.Timeout)
+	}
+
+	if cfg.NativeHistogramBucketFactor != 0 && cfg.NativeHistogramBucketFactor <= 1 {
+		return fmt.Errorf("fiberprometheus: NativeHistogramBucketFactor must be greater than 1, got %v", cfg.NativeHistogramBucketFactor)
+	}
+	if cfg.NativeHistogramMinResetDuration < 0 {
+		return fmt.Errorf("fiberprometheus: NativeHistogramMinResetDuration must not be negative, got %v", cfg.NativeHistogramMinResetDuration)
+	}
+	if cfg.DisableClassicBuckets && cfg.NativeHistogramBucketFactor == 0 {
+		return fmt.Errorf("fiberprometheus: DisableClassicBuckets requires NativeHistogramBucketFactor")
+	}
+
+	return nil
+}
+
+// validateBuckets ensures the bucket upper bounds are strictly increasing.
+func validateBuckets(buckets []float64) error {
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return fmt.Errorf("buckets must be in strictly increasing order, got %v before %v", buckets[i-1], buckets[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,387 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewWithConfig(t *testing.T) {
+	t.Parallel()
+
+	app := fiber.New()
+	prometheus, err := NewWithConfig(Config{
+		ServiceName:       "config-service",
+		Namespace:         "my_app",
+		Subsystem:         "http",
+		ConstLabels:       map[string]string{"env": "test"},
+		SkipPaths:         []string{"/healthz/"},
+		IgnoreStatusCodes: []int{fiber.StatusNotFound},
+		Next: func(c *fiber.Ctx) bool {
+			return c.Get("X-Skip-Metrics") != ""
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(prometheus.Middleware)
+
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("Hello World") })
+	app.Get("/healthz", func(c *fiber.Ctx) error { return c.SendString("OK") })
+	app.Get("/missing", func(c *fiber.Ctx) error { return fiber.ErrNotFound })
+
+	app.Test(httptest.NewRequest("GET", "/", nil), -1)
+	app.Test(httptest.NewRequest("GET", "/healthz", nil), -1)
+	app.Test(httptest.NewRequest("GET", "/missing", nil), -1)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Skip-Metrics", "1")
+	app.Test(req, -1)
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+
+	want := `my_app_http_requests_total{env="test",method="GET",path="/",service="config-service",status_code="200"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+	if strings.Contains(got, `path="/healthz"`) {
+		t.Errorf("metrics should skip /healthz: %s", got)
+	}
+	if strings.Contains(got, `path="/missing"`) {
+		t.Errorf("metrics should ignore status 404: %s", got)
+	}
+}
+
+func TestNewWithConfigDefaults(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	ps, err := NewWithConfig(Config{Registerer: registry})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+	if ps.gatherer != registry {
+		t.Errorf("expected the registerer to be used as gatherer")
+	}
+
+	ps.requestDuration.WithLabelValues("200", "GET", "/").Observe(1)
+	h := gatherHistogram(t, registry, "request_duration_seconds")
+	if got := len(h.GetBucket()); got != len(DefaultBuckets) {
+		t.Errorf("got %d buckets; want %d", got, len(DefaultBuckets))
+	}
+}
+
+func TestNewWithConfigValidation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "invalid namespace", cfg: Config{Namespace: "my-app"}},
+		{name: "invalid const label", cfg: Config{ConstLabels: map[string]string{"1st": "x"}}},
+		{name: "const label collides with variable label", cfg: Config{ConstLabels: map[string]string{"path": "x"}}},
+		{name: "const label collides with service", cfg: Config{ServiceName: "svc", ConstLabels: map[string]string{"service": "x"}}},
+		{name: "invalid status code", cfg: Config{IgnoreStatusCodes: []int{42}}},
+		{name: "unsorted buckets", cfg: Config{Buckets: []float64{1, 0.5}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := prometheus.NewRegistry()
+			tt.cfg.Registerer = registry
+			if _, err := NewWithConfig(tt.cfg); err == nil {
+				t.Fatal("expected an error")
+			}
+			if families, _ := registry.Gather(); len(families) != 0 {
+				t.Errorf("no collector should be registered on error, got %d families", len(families))
+			}
+		})
+	}
+}
+
+func TestMetricOverrides(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	ps, err := NewWithConfig(Config{
+		Registerer: registry,
+		Metrics: map[Metric]MetricOpts{
+			MetricRequestsTotal:    {Name: "http_requests_total", Help: "Requests by code, method and route."},
+			MetricRequestDuration:  {Disable: true},
+			MetricRequestsInFlight: {Disable: true},
+		},
+		StatusCodeLabel: "code",
+		PathLabel:       "route",
+		InitStatusCodes: []int{fiber.StatusOK},
+		SeriesTTL:       time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+	defer ps.Close()
+
+	app := fiber.New()
+	ps.RegisterAt(app, "/metrics")
+	app.Use(ps.Middleware)
+	app.Get("/users/:id", func(c *fiber.Ctx) error { return c.SendString("user") })
+
+	app.Test(httptest.NewRequest("GET", "/users/1", nil), -1)
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+
+	for _, want := range []string{
+		`# HELP http_requests_total Requests by code, method and route.`,
+		`http_requests_total{code="200",method="GET",route="/users/:id"} 1`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %s; want %s", got, want)
+		}
+	}
+	for _, unwanted := range []string{"# TYPE request_duration_seconds ", "# TYPE requests_in_progress_total "} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("%s should be disabled: %s", unwanted, got)
+		}
+	}
+}
+
+func TestMetricOverridesValidation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "unknown metric", cfg: Config{Metrics: map[Metric]MetricOpts{Metric(42): {Name: "x"}}}},
+		{name: "invalid name", cfg: Config{Metrics: map[Metric]MetricOpts{MetricRequestsTotal: {Name: "requests-total"}}}},
+		{name: "duplicate name", cfg: Config{Metrics: map[Metric]MetricOpts{MetricRequestsTotal: {Name: "request_duration_seconds"}}}},
+		{name: "invalid label", cfg: Config{StatusCodeLabel: "status-code"}},
+		{name: "reserved label", cfg: Config{PathLabel: "__path"}},
+		{name: "duplicate label", cfg: Config{PathLabel: "method"}},
+		{name: "label collides with app", cfg: Config{AppLabel: true, PathLabel: "app"}},
+		{name: "label collides with attribute", cfg: Config{Naming: NamingEcho, PathLabel: "host"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWithConfig(tt.cfg); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+
+	// A disabled metric may share the name of another one
+	if _, err := NewWithConfig(Config{Metrics: map[Metric]MetricOpts{
+		MetricRequestsTotal:    {Name: "requests_in_progress_total"},
+		MetricRequestsInFlight: {Disable: true},
+	}}); err != nil {
+		t.Errorf("NewWithConfig: %v", err)
+	}
+}
+
+func TestBucketPresets(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		buckets []float64
+	}{
+		{name: "prometheus defaults", buckets: PrometheusDefaultBuckets},
+		{name: "web latency", buckets: WebLatencyBuckets},
+		{name: "exponential", buckets: ExponentialBuckets(0.001, 2, 12)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := prometheus.NewRegistry()
+			ps, err := NewWithConfig(Config{Registerer: registry, Buckets: tt.buckets})
+			if err != nil {
+				t.Fatalf("NewWithConfig: %v", err)
+			}
+			ps.requestDuration.WithLabelValues("200", "GET", "/").Observe(0.01)
+
+			h := gatherHistogram(t, registry, "request_duration_seconds")
+			if got := len(h.GetBucket()); got != len(tt.buckets) {
+				t.Errorf("got %d buckets; want %d", got, len(tt.buckets))
+			}
+		})
+	}
+}
+
+func TestNativeHistogram(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		disableClassic bool
+		wantBuckets    int
+	}{
+		{name: "with classic buckets", wantBuckets: len(PrometheusDefaultBuckets)},
+		{name: "native only", disableClassic: true, wantBuckets: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := prometheus.NewRegistry()
+			ps, err := NewWithConfig(Config{
+				Registerer:                      registry,
+				Buckets:                         PrometheusDefaultBuckets,
+				NativeHistogramBucketFactor:     1.1,
+				NativeHistogramMaxBucketNumber:  100,
+				NativeHistogramMinResetDuration: time.Hour,
+				DisableClassicBuckets:           tt.disableClassic,
+			})
+			if err != nil {
+				t.Fatalf("NewWithConfig: %v", err)
+			}
+			ps.requestDuration.WithLabelValues("200", "GET", "/").Observe(0.01)
+
+			h := gatherHistogram(t, registry, "request_duration_seconds")
+			if h.Schema == nil {
+				t.Errorf("expected a native histogram schema")
+			}
+			if got := len(h.GetBucket()); got != tt.wantBuckets {
+				t.Errorf("got %d classic buckets; want %d", got, tt.wantBuckets)
+			}
+		})
+	}
+}
+
+func TestNativeHistogramValidation(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewWithConfig(Config{NativeHistogramBucketFactor: 0.5}); err == nil {
+		t.Error("expected an error for a bucket factor below 1")
+	}
+	if _, err := NewWithConfig(Config{DisableClassicBuckets: true}); err == nil {
+		t.Error("expected an error when disabling classic buckets without native histograms")
+	}
+}
+
+// gatherHistogram returns the first histogram of the named family.
+func TestDurationSummary(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	ps, err := NewWithConfig(Config{
+		Registerer:            registry,
+		EnableDurationSummary: true,
+		SummaryObjectives:     map[float64]float64{0.5: 0.05, 0.99: 0.001},
+		SummaryMaxAge:         time.Minute,
+		SummaryAgeBuckets:     3,
+		Metrics: map[Metric]MetricOpts{
+			MetricRequestDuration:        {Disable: true},
+			MetricRequestDurationSummary: {Name: "request_duration_seconds"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+
+	app := fiber.New()
+	app.Use(ps.Middleware)
+	// Traced requests are observed without exemplar
+	app.Use(func(c *fiber.Ctx) error {
+		c.SetUserContext(trace.ContextWithSpanContext(c.UserContext(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{1},
+			SpanID:     trace.SpanID{1},
+			TraceFlags: trace.FlagsSampled,
+		})))
+		return c.Next()
+	})
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("Hello World") })
+	app.Test(httptest.NewRequest("GET", "/", nil), -1)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	var summary *dto.Summary
+	for _, mf := range families {
+		if mf.GetName() == "request_duration_seconds" {
+			if mf.GetType() != dto.MetricType_SUMMARY {
+				t.Fatalf("got %v; want a summary", mf.GetType())
+			}
+			summary = mf.GetMetric()[0].GetSummary()
+		}
+	}
+	if summary == nil {
+		t.Fatal("request_duration_seconds not found")
+	}
+	if got := summary.GetSampleCount(); got != 1 {
+		t.Errorf("got %d samples; want 1", got)
+	}
+	var quantiles []float64
+	for _, q := range summary.GetQuantile() {
+		quantiles = append(quantiles, q.GetQuantile())
+	}
+	if len(quantiles) != 2 || quantiles[0] != 0.5 || quantiles[1] != 0.99 {
+		t.Errorf("got quantiles %v; want [0.5 0.99]", quantiles)
+	}
+}
+
+func TestDurationSummaryValidation(t *testing.T) {
+	t.Parallel()
+
+	for _, cfg := range []Config{
+		{EnableDurationSummary: true, SummaryObjectives: map[float64]float64{1.5: 0.01}},
+		{EnableDurationSummary: true, SummaryObjectives: map[float64]float64{0.5: -0.01}},
+		{EnableDurationSummary: true, SummaryMaxAge: -time.Minute},
+		{EnableDurationSummary: true, Metrics: map[Metric]MetricOpts{MetricRequestDurationSummary: {Name: "request_duration_seconds"}}},
+	} {
+		if _, err := NewWithConfig(cfg); err == nil {
+			t.Errorf("expected an error for %+v", cfg)
+		}
+	}
+}
+
+func gatherHistogram(t *testing.T, registry prometheus.Gatherer, name string) *dto.Histogram {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, mf := range families {
+		if mf.GetName() == name {
+			return mf.GetMetric()[0].GetHistogram()
+		}
+	}
+	t.Fatalf("%s not found", name)
+	return nil
+}
@@ -0,0 +1,57 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import "time"
+
+// minSeriesExpiryInterval is the lower bound of the default expiry interval,
+// which keeps tiny TTLs from spinning the expiry goroutine.
+const minSeriesExpiryInterval = time.Millisecond
+
+// runExpiry deletes the series idle for longer than ttl every interval,
+// until stop is closed.
+func (ps *FiberPrometheus) runExpiry(ttl, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			ps.expireSeries(now.Add(-ttl))
+		}
+	}
+}
+
+// expireSeries deletes the series last updated before the given time.
+func (ps *FiberPrometheus) expireSeries(before time.Time) {
+	for _, m := range requestMetrics {
+		t := ps.trackers[m]
+		if t == nil {
+			continue
+		}
+		if evicted := t.expire(before.UnixNano()); evicted > 0 {
+			ps.seriesEvicted.WithLabelValues(m.String()).Add(float64(evicted))
+		}
+	}
+}
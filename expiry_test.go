@@ -0,0 +1,176 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSeriesExpiry(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	ps, err := NewWithConfig(Config{
+		Registerer:         registry,
+		SeriesTTL:          time.Hour,
+		EnableResponseSize: true,
+	})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+	defer ps.Close()
+
+	app := fiber.New()
+	ps.RegisterAt(app, "/metrics")
+	app.Use(ps.Middleware)
+	app.Get("/old", func(c *fiber.Ctx) error { return c.SendString("old") })
+	app.Get("/new", func(c *fiber.Ctx) error { return c.SendString("new") })
+
+	app.Test(httptest.NewRequest("GET", "/old", nil), -1)
+	cutoff := time.Now()
+	app.Test(httptest.NewRequest("GET", "/new", nil), -1)
+
+	ps.expireSeries(cutoff)
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+
+	if strings.Contains(got, `path="/old"`) {
+		t.Errorf("expected the /old series to expire: %s", got)
+	}
+	for _, want := range []string{
+		`requests_total{method="GET",path="/new",status_code="200"} 1`,
+		`response_size_bytes_count{method="GET",path="/new",status_code="200"} 1`,
+		`series_evicted_total{metric="requests_total"} 1`,
+		`series_evicted_total{metric="request_duration_seconds"} 1`,
+		`series_evicted_total{metric="response_size_bytes"} 1`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %s; want %s", got, want)
+		}
+	}
+}
+
+func TestSeriesExpiryInBackground(t *testing.T) {
+	t.Parallel()
+
+	ps, err := NewWithConfig(Config{SeriesTTL: 20 * time.Millisecond, SeriesExpiryInterval: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+	defer ps.Close()
+
+	app := fiber.New()
+	app.Use(ps.Middleware)
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("Hello World") })
+	app.Test(httptest.NewRequest("GET", "/", nil), -1)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.CollectAndCount(ps.requestsTotal) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("series did not expire")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSeriesExpiryTinyTTL(t *testing.T) {
+	t.Parallel()
+
+	if got := configDefault(Config{SeriesTTL: time.Nanosecond}).SeriesExpiryInterval; got != minSeriesExpiryInterval {
+		t.Errorf("got interval %v; want %v", got, minSeriesExpiryInterval)
+	}
+
+	ps, err := NewWithConfig(Config{SeriesTTL: time.Nanosecond})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+	defer ps.Close()
+
+	app := fiber.New()
+	app.Use(ps.Middleware)
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("Hello World") })
+	app.Test(httptest.NewRequest("GET", "/", nil), -1)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.CollectAndCount(ps.requestsTotal) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("series did not expire")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSeriesExpiryConcurrency(t *testing.T) {
+	t.Parallel()
+
+	ps, err := NewWithConfig(Config{SeriesTTL: time.Hour})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+	defer ps.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			values := labelValues{base: []string{"200", "GET", "/" + strconv.Itoa(i%2)}}
+			for j := 0; j < 1000; j++ {
+				ps.requestsTotal.WithLabelValues(ps.seriesValues(MetricRequestsTotal, values)...).Inc()
+			}
+		}(i)
+	}
+	for i := 0; i < 100; i++ {
+		ps.expireSeries(time.Now())
+	}
+	wg.Wait()
+
+	// Every remaining series is tracked, so it expires eventually.
+	ps.expireSeries(time.Now())
+	if got := testutil.CollectAndCount(ps.requestsTotal); got != 0 {
+		t.Errorf("got %d untracked series", got)
+	}
+}
+
+func TestSeriesTTLValidation(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewWithConfig(Config{SeriesTTL: -time.Second}); err == nil {
+		t.Error("expected an error for a negative SeriesTTL")
+	}
+	if _, err := NewWithConfig(Config{SeriesTTL: time.Second, SeriesExpiryInterval: -time.Second}); err == nil {
+		t.Error("expected an error for a negative SeriesExpiryInterval")
+	}
+}
@@ -0,0 +1,251 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// metricsFilter selects the gathered metric families to serve, from the
+// name[] and match[] query parameters of a scrape.
+type metricsFilter struct {
+	names     map[string]bool
+	selectors [][]labelMatcher
+}
+
+// labelMatcher matches a label value, like in a PromQL selector.
+type labelMatcher struct {
+	name   string
+	op     string
+	value  string
+	regexp *regexp.Regexp
+}
+
+// newMetricsFilter parses the name[] and match[] query parameters. It returns
+// nil if neither is set.
+func newMetricsFilter(ctx *fiber.Ctx) (*metricsFilter, error) {
+	args := ctx.Context().QueryArgs()
+	names := args.PeekMulti("name[]")
+	matches := args.PeekMulti("match[]")
+	if len(names) == 0 && len(matches) == 0 {
+		return nil, nil
+	}
+
+	f := &metricsFilter{}
+	if len(names) > 0 {
+		f.names = make(map[string]bool, len(names))
+		for _, name := range names {
+			f.names[string(name)] = true
+		}
+	}
+	for _, match := range matches {
+		selector, err := parseSelector(string(match))
+		if err != nil {
+			return nil, err
+		}
+		f.selectors = append(f.selectors, selector)
+	}
+	return f, nil
+}
+
+// filter returns the families whose name is listed in name[], keeping only
+// the metrics matched by any match[] selector. The gathered families are not
+// modified.
+func (f *metricsFilter) filter(mfs []*dto.MetricFamily) []*dto.MetricFamily {
+	filtered := make([]*dto.MetricFamily, 0, len(mfs))
+	for _, mf := range mfs {
+		if f.names != nil && !f.names[mf.GetName()] {
+			continue
+		}
+		if len(f.selectors) == 0 {
+			filtered = append(filtered, mf)
+			continue
+		}
+
+		names := sampleNames(mf)
+		var metrics []*dto.Metric
+		for _, m := range mf.GetMetric() {
+			if f.matches(names, m) {
+				metrics = append(metrics, m)
+			}
+		}
+		if len(metrics) == 0 {
+			continue
+		}
+		filtered = append(filtered, &dto.MetricFamily{
+			Name:   mf.Name,
+			Help:   mf.Help,
+			Type:   mf.Type,
+			Unit:   mf.Unit,
+			Metric: metrics,
+		})
+	}
+	return filtered
+}
+
+// sampleNames returns the names the samples of a family are exposed under:
+// the family name, and the _bucket, _count and _sum series of histograms and
+// summaries.
+func sampleNames(mf *dto.MetricFamily) []string {
+	name := mf.GetName()
+	switch mf.GetType() {
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		return []string{name, name + "_bucket", name + "_count", name + "_sum"}
+	case dto.MetricType_SUMMARY:
+		return []string{name, name + "_count", name + "_sum"}
+	default:
+		return []string{name}
+	}
+}
+
+// matches reports whether any selector matches the metric under any of its
+// sample names. A histogram or summary is served whole once one of its
+// samples matches.
+func (f *metricsFilter) matches(names []string, m *dto.Metric) bool {
+	for _, selector := range f.selectors {
+		for _, name := range names {
+			if selectorMatches(selector, name, m) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func selectorMatches(selector []labelMatcher, name string, m *dto.Metric) bool {
+	for _, lm := range selector {
+		value := name
+		if lm.name != "__name__" {
+			value = ""
+			for _, lp := range m.GetLabel() {
+				if lp.GetName() == lm.name {
+					value = lp.GetValue()
+					break
+				}
+			}
+		}
+		if !lm.matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (lm labelMatcher) matches(value string) bool {
+	switch lm.op {
+	case "=":
+		return value == lm.value
+	case "!=":
+		return value != lm.value
+	case "=~":
+		return lm.regexp.MatchString(value)
+	default: // "!~"
+		return !lm.regexp.MatchString(value)
+	}
+}
+
+// parseSelector parses a PromQL series selector such as
+// `http_requests_total{method="GET",path=~"/api/.*"}`.
+func parseSelector(s string) ([]labelMatcher, error) {
+	input := s
+	s = strings.TrimSpace(s)
+
+	var selector []labelMatcher
+	end := strings.IndexByte(s, '{')
+	if end < 0 {
+		end = len(s)
+	}
+	if name := strings.TrimSpace(s[:end]); name != "" {
+		selector = append(selector, labelMatcher{name: "__name__", op: "=", value: name})
+	}
+	s = s[end:]
+
+	if s != "" {
+		if !strings.HasSuffix(s, "}") {
+			return nil, fmt.Errorf("fiberprometheus: invalid selector %q: missing closing brace", input)
+		}
+		s = strings.TrimSpace(s[1 : len(s)-1])
+		for s != "" {
+			lm, rest, err := parseLabelMatcher(s)
+			if err != nil {
+				return nil, fmt.Errorf("fiberprometheus: invalid selector %q: %w", input, err)
+			}
+			selector = append(selector, lm)
+
+			s = strings.TrimSpace(rest)
+			if s != "" {
+				if s[0] != ',' {
+					return nil, fmt.Errorf("fiberprometheus: invalid selector %q: expected a comma", input)
+				}
+				s = strings.TrimSpace(s[1:])
+			}
+		}
+	}
+
+	if len(selector) == 0 {
+		return nil, fmt.Errorf("fiberprometheus: invalid selector %q: no matchers", input)
+	}
+	return selector, nil
+}
+
+// parseLabelMatcher parses the first `label op "value"` of s and returns the
+// rest of s.
+func parseLabelMatcher(s string) (labelMatcher, string, error) {
+	i := strings.IndexAny(s, "=!")
+	if i <= 0 {
+		return labelMatcher{}, "", fmt.Errorf("expected a label matcher at %q", s)
+	}
+	lm := labelMatcher{name: strings.TrimSpace(s[:i])}
+	s = s[i:]
+
+	for _, op := range []string{"=~", "!~", "!=", "="} {
+		if strings.HasPrefix(s, op) {
+			lm.op = op
+			break
+		}
+	}
+	if lm.op == "" {
+		return labelMatcher{}, "", fmt.Errorf("unknown operator at %q", s)
+	}
+	s = strings.TrimSpace(s[len(lm.op):])
+
+	quoted, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return labelMatcher{}, "", fmt.Errorf("expected a quoted value at %q", s)
+	}
+	if lm.value, err = strconv.Unquote(quoted); err != nil {
+		return labelMatcher{}, "", err
+	}
+	if lm.op == "=~" || lm.op == "!~" {
+		// Like PromQL, regular expressions are fully anchored.
+		if lm.regexp, err = regexp.Compile("^(?:" + lm.value + ")$"); err != nil {
+			return labelMatcher{}, "", err
+		}
+	}
+	return lm, s[len(quoted):], nil
+}
@@ -0,0 +1,137 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestMetricsFilter(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests_total", Help: "Requests."}, []string{"method", "path"})
+	errorsTotal := prometheus.NewCounter(prometheus.CounterOpts{Name: "errors_total", Help: "Errors."})
+	duration := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "duration_seconds", Help: "Duration."})
+	registry.MustRegister(requests, errorsTotal, duration)
+	requests.WithLabelValues("GET", "/").Inc()
+	requests.WithLabelValues("GET", "/api/users").Inc()
+	requests.WithLabelValues("POST", "/api/users").Inc()
+
+	app := newHandlerTestApp(registry, promhttp.HandlerOpts{})
+
+	tests := []struct {
+		name    string
+		query   url.Values
+		want    []string
+		notWant []string
+	}{
+		{
+			name:  "no filter",
+			query: url.Values{},
+			want:  []string{"errors_total 0", `requests_total{method="GET",path="/"} 1`},
+		},
+		{
+			name:    "by name",
+			query:   url.Values{"name[]": {"errors_total"}},
+			want:    []string{"errors_total 0"},
+			notWant: []string{"requests_total"},
+		},
+		{
+			name:    "by label matcher",
+			query:   url.Values{"match[]": {`{method="GET",path=~"/api/.*"}`}},
+			want:    []string{`requests_total{method="GET",path="/api/users"} 1`},
+			notWant: []string{`path="/"`, `method="POST"`, "errors_total"},
+		},
+		{
+			name:    "selectors are or-ed",
+			query:   url.Values{"match[]": {`errors_total`, `requests_total{method!="GET"}`}},
+			want:    []string{"errors_total 0", `requests_total{method="POST",path="/api/users"} 1`},
+			notWant: []string{`method="GET"`},
+		},
+		{
+			name:    "histogram sample name",
+			query:   url.Values{"match[]": {`{__name__="duration_seconds_count"}`}},
+			want:    []string{"duration_seconds_count 0", "duration_seconds_bucket{le=\"+Inf\"} 0"},
+			notWant: []string{"requests_total", "errors_total"},
+		},
+		{
+			name:    "name and matcher",
+			query:   url.Values{"name[]": {"requests_total"}, "match[]": {`{path!~"/api/.*"}`}},
+			want:    []string{`requests_total{method="GET",path="/"} 1`},
+			notWant: []string{"errors_total", `path="/api/users"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _ := app.Test(httptest.NewRequest("GET", "/metrics?"+tt.query.Encode(), nil), -1)
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			got := string(body)
+
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("got %s; want it to contain %s", got, want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("got %s; want it not to contain %s", got, notWant)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSelectorErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, selector := range []string{
+		"",
+		"{}",
+		`{method="GET"`,
+		`{method=GET}`,
+		`{method~"GET"}`,
+		`{method="GET" path="/"}`,
+		`{path=~"("}`,
+	} {
+		if _, err := parseSelector(selector); err == nil {
+			t.Errorf("parseSelector(%q): expected an error", selector)
+		}
+	}
+
+	app := fiber.New()
+	app.Get("/metrics", newMetricsHandler(prometheus.NewRegistry(), promhttp.HandlerOpts{}))
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics?"+url.Values{"match[]": {"{"}}.Encode(), nil), -1)
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("got status %d; want %d", resp.StatusCode, fiber.StatusBadRequest)
+	}
+}
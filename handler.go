@@ -0,0 +1,296 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// defaultCompressions are offered when HandlerOpts.OfferedCompressions is
+// empty, in order of preference.
+var defaultCompressions = []string{
+	string(promhttp.Identity),
+	string(promhttp.Gzip),
+	string(promhttp.Zstd),
+}
+
+var (
+	gzipPool = sync.Pool{
+		New: func() interface{} {
+			return gzip.NewWriter(nil)
+		},
+	}
+	zstdPool = sync.Pool{
+		New: func() interface{} {
+			w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+			return w
+		},
+	}
+)
+
+// metricsHandler serves the metrics of a gatherer directly on the fasthttp
+// request, honouring promhttp.HandlerOpts like promhttp.HandlerFor does.
+type metricsHandler struct {
+	gatherer     prometheus.Gatherer
+	opts         promhttp.HandlerOpts
+	compressions []string
+	inFlightSem  chan struct{}
+	errorsTotal  *prometheus.CounterVec
+}
+
+// newMetricsHandler returns the handler serving the metrics of gatherer.
+// Like promhttp.HandlerFor, it panics if opts.Registry is set and the errors
+// counter can't be registered.
+func newMetricsHandler(gatherer prometheus.Gatherer, opts promhttp.HandlerOpts) fiber.Handler {
+	h := &metricsHandler{
+		gatherer: gatherer,
+		opts:     opts,
+		errorsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "promhttp_metric_handler_errors_total",
+				Help: "Total number of internal errors encountered by the promhttp metric handler.",
+			},
+			[]string{"cause"},
+		),
+	}
+
+	if opts.MaxRequestsInFlight > 0 {
+		h.inFlightSem = make(chan struct{}, opts.MaxRequestsInFlight)
+	}
+	if opts.Registry != nil {
+		h.errorsTotal.WithLabelValues("gathering")
+		h.errorsTotal.WithLabelValues("encoding")
+		if err := opts.Registry.Register(h.errorsTotal); err != nil {
+			are := prometheus.AlreadyRegisteredError{}
+			if !errors.As(err, &are) {
+				panic(err)
+			}
+			h.errorsTotal = are.ExistingCollector.(*prometheus.CounterVec)
+		}
+	}
+
+	if !opts.DisableCompression {
+		h.compressions = defaultCompressions
+		if len(opts.OfferedCompressions) > 0 {
+			h.compressions = make([]string, 0, len(opts.OfferedCompressions))
+			for _, c := range opts.OfferedCompressions {
+				h.compressions = append(h.compressions, string(c))
+			}
+		}
+	}
+
+	return h.serve
+}
+
+// serve gathers and encodes the metrics into the response body, keeping only
+// the families selected by the name[] and match[] query parameters if set.
+func (h *metricsHandler) serve(ctx *fiber.Ctx) error {
+	if !h.opts.ProcessStartTime.IsZero() {
+		ctx.Set("Process-Start-Time-Unix", strconv.FormatInt(h.opts.ProcessStartTime.Unix(), 10))
+	}
+	if h.inFlightSem != nil {
+		select {
+		case h.inFlightSem <- struct{}{}:
+			defer func() { <-h.inFlightSem }()
+		default:
+			return ctx.Status(fiber.StatusServiceUnavailable).SendString(fmt.Sprintf(
+				"Limit of concurrent requests reached (%d), try again later.\n", h.opts.MaxRequestsInFlight,
+			))
+		}
+	}
+
+	filter, err := newMetricsFilter(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).SendString(err.Error() + "\n")
+	}
+
+	mfs, err := h.gather()
+	if errors.Is(err, errGatherTimeout) {
+		return ctx.Status(fiber.StatusServiceUnavailable).SendString(fmt.Sprintf(
+			"Exceeded configured timeout of %v.\n", h.opts.Timeout,
+		))
+	}
+	if err != nil {
+		h.logError("error gathering metrics:", err)
+		h.errorsTotal.WithLabelValues("gathering").Inc()
+		switch h.opts.ErrorHandling {
+		case promhttp.PanicOnError:
+			panic(err)
+		case promhttp.ContinueOnError:
+			if len(mfs) == 0 {
+				// Still report the error if no metrics have been gathered.
+				return sendMetricsError(ctx, err)
+			}
+		case promhttp.HTTPErrorOnError:
+			return sendMetricsError(ctx, err)
+		}
+	}
+
+	if filter != nil {
+		mfs = filter.filter(mfs)
+	}
+
+	var format expfmt.Format
+	header := http.Header{fiber.HeaderAccept: []string{ctx.Get(fiber.HeaderAccept)}}
+	if h.opts.EnableOpenMetrics {
+		format = expfmt.NegotiateIncludingOpenMetrics(header)
+	} else {
+		format = expfmt.Negotiate(header)
+	}
+	ctx.Set(fiber.HeaderContentType, string(format))
+
+	w, encoding, closeWriter := h.bodyWriter(ctx)
+	if encoding != string(promhttp.Identity) {
+		ctx.Set(fiber.HeaderContentEncoding, encoding)
+	}
+
+	var enc expfmt.Encoder
+	if h.opts.EnableOpenMetricsTextCreatedSamples {
+		enc = expfmt.NewEncoder(w, format, expfmt.WithCreatedLines())
+	} else {
+		enc = expfmt.NewEncoder(w, format)
+	}
+
+	for _, mf := range mfs {
+		if err := enc.Encode(mf); err != nil && h.encodingFailed(err) {
+			closeWriter()
+			return sendMetricsError(ctx, err)
+		}
+	}
+	if closer, ok := enc.(expfmt.Closer); ok {
+		// This writes the final "# EOF" line for OpenMetrics.
+		if err := closer.Close(); err != nil && h.encodingFailed(err) {
+			closeWriter()
+			return sendMetricsError(ctx, err)
+		}
+	}
+	closeWriter()
+	return nil
+}
+
+// errGatherTimeout is returned by gather when opts.Timeout expires.
+var errGatherTimeout = errors.New("fiberprometheus: gathering metrics timed out")
+
+// gather gathers the metrics, giving up with errGatherTimeout after
+// opts.Timeout if it is set.
+func (h *metricsHandler) gather() ([]*dto.MetricFamily, error) {
+	if h.opts.Timeout <= 0 {
+		return h.gatherer.Gather()
+	}
+
+	type result struct {
+		mfs []*dto.MetricFamily
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		mfs, err := h.gatherer.Gather()
+		done <- result{mfs: mfs, err: err}
+	}()
+
+	timer := time.NewTimer(h.opts.Timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.mfs, r.err
+	case <-timer.C:
+		return nil, errGatherTimeout
+	}
+}
+
+// encodingFailed handles an encoding error according to opts.ErrorHandling
+// and reports whether serving has to be aborted.
+func (h *metricsHandler) encodingFailed(err error) bool {
+	h.logError("error encoding and sending metric family:", err)
+	h.errorsTotal.WithLabelValues("encoding").Inc()
+	switch h.opts.ErrorHandling {
+	case promhttp.PanicOnError:
+		panic(err)
+	case promhttp.HTTPErrorOnError:
+		return true
+	}
+	return false
+}
+
+func (h *metricsHandler) logError(msg string, err error) {
+	if h.opts.ErrorLog != nil {
+		h.opts.ErrorLog.Println(msg, err)
+	}
+}
+
+// bodyWriter returns a writer compressing into the response body with the
+// content encoding negotiated from the Accept-Encoding header. closeWriter
+// flushes the writer and must be called once encoding is done.
+func (h *metricsHandler) bodyWriter(ctx *fiber.Ctx) (w io.Writer, encoding string, closeWriter func()) {
+	body := ctx.Response().BodyWriter()
+	if len(h.compressions) == 0 {
+		return body, string(promhttp.Identity), func() {}
+	}
+
+	switch encoding = ctx.AcceptsEncodings(h.compressions...); encoding {
+	case string(promhttp.Gzip):
+		gz := gzipPool.Get().(*gzip.Writer)
+		gz.Reset(body)
+		return gz, encoding, func() {
+			_ = gz.Close()
+			gzipPool.Put(gz)
+		}
+	case string(promhttp.Zstd):
+		z := zstdPool.Get().(*zstd.Encoder)
+		z.Reset(body)
+		return z, encoding, func() {
+			_ = z.Close()
+			zstdPool.Put(z)
+		}
+	case string(promhttp.Identity):
+		return body, encoding, func() {}
+	default:
+		if encoding != "" {
+			h.logError("error getting writer", fmt.Errorf("content compression format not recognized: %s", encoding))
+		}
+		return body, string(promhttp.Identity), func() {}
+	}
+}
+
+// sendMetricsError replaces the response with a plain text error, like
+// promhttp does when serving metrics fails.
+func sendMetricsError(ctx *fiber.Ctx, err error) error {
+	ctx.Response().ResetBody()
+	ctx.Response().Header.Del(fiber.HeaderContentEncoding)
+	ctx.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+	ctx.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	return ctx.Status(fiber.StatusInternalServerError).SendString("An error has occurred while serving metrics:\n\n" + err.Error() + "\n")
+}
@@ -0,0 +1,214 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func newHandlerTestApp(gatherer prometheus.Gatherer, opts promhttp.HandlerOpts) *fiber.App {
+	app := fiber.New()
+	app.Get("/metrics", newMetricsHandler(gatherer, opts))
+	return app
+}
+
+func TestMetricsHandlerFormats(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "handler_test_total", Help: "Test counter."})
+	registry.MustRegister(counter)
+	counter.Inc()
+
+	tests := []struct {
+		name            string
+		accept          string
+		openMetrics     bool
+		wantContentType string
+		wantBody        string
+	}{
+		{name: "text by default", wantContentType: "text/plain; version=0.0.4", wantBody: "handler_test_total 1\n"},
+		{name: "openmetrics disabled", accept: "application/openmetrics-text", wantContentType: "text/plain; version=0.0.4", wantBody: "handler_test_total 1\n"},
+		{name: "openmetrics", accept: "application/openmetrics-text", openMetrics: true, wantContentType: "application/openmetrics-text; version=", wantBody: "# EOF\n"},
+		{name: "protobuf", accept: "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited", wantContentType: "application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=delimited", wantBody: "handler_test_total"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newHandlerTestApp(registry, promhttp.HandlerOpts{EnableOpenMetrics: tt.openMetrics})
+
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			resp, _ := app.Test(req, -1)
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, tt.wantContentType) {
+				t.Errorf("got content type %q; want prefix %q", got, tt.wantContentType)
+			}
+			if !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("got %q; want it to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestMetricsHandlerCompression(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "handler_test_total", Help: "Test counter."}))
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		opts           promhttp.HandlerOpts
+		wantEncoding   string
+	}{
+		{name: "identity", wantEncoding: ""},
+		{name: "gzip", acceptEncoding: "gzip", wantEncoding: "gzip"},
+		{name: "zstd preferred", acceptEncoding: "gzip;q=0.5, zstd", wantEncoding: "zstd"},
+		{name: "unsupported", acceptEncoding: "br", wantEncoding: ""},
+		{name: "disabled", acceptEncoding: "gzip", opts: promhttp.HandlerOpts{DisableCompression: true}, wantEncoding: ""},
+		{name: "offered", acceptEncoding: "zstd, gzip;q=0.5", opts: promhttp.HandlerOpts{OfferedCompressions: []promhttp.Compression{promhttp.Gzip}}, wantEncoding: "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newHandlerTestApp(registry, tt.opts)
+
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			resp, _ := app.Test(req, -1)
+			defer resp.Body.Close()
+
+			if got := resp.Header.Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("got encoding %q; want %q", got, tt.wantEncoding)
+			}
+
+			var r io.Reader = resp.Body
+			switch tt.wantEncoding {
+			case "gzip":
+				gz, err := gzip.NewReader(resp.Body)
+				if err != nil {
+					t.Fatalf("gzip.NewReader: %v", err)
+				}
+				r = gz
+			case "zstd":
+				z, err := zstd.NewReader(resp.Body)
+				if err != nil {
+					t.Fatalf("zstd.NewReader: %v", err)
+				}
+				defer z.Close()
+				r = z
+			}
+			body, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("reading body: %v", err)
+			}
+			if !strings.Contains(string(body), "handler_test_total 0\n") {
+				t.Errorf("unexpected body %q", body)
+			}
+		})
+	}
+}
+
+// blockingGatherer blocks every gather until release is closed.
+type blockingGatherer struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (g *blockingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	g.started <- struct{}{}
+	<-g.release
+	return nil, nil
+}
+
+func TestMetricsHandlerLimits(t *testing.T) {
+	t.Parallel()
+
+	t.Run("max requests in flight", func(t *testing.T) {
+		gatherer := &blockingGatherer{started: make(chan struct{}, 1), release: make(chan struct{})}
+		app := newHandlerTestApp(gatherer, promhttp.HandlerOpts{MaxRequestsInFlight: 1})
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+		}()
+		<-gatherer.started
+
+		resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+		if resp.StatusCode != fiber.StatusServiceUnavailable {
+			t.Errorf("got status %d; want %d", resp.StatusCode, fiber.StatusServiceUnavailable)
+		}
+		close(gatherer.release)
+		<-done
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		gatherer := &blockingGatherer{started: make(chan struct{}, 1), release: make(chan struct{})}
+		defer close(gatherer.release)
+		app := newHandlerTestApp(gatherer, promhttp.HandlerOpts{Timeout: 10 * time.Millisecond})
+
+		resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+		if resp.StatusCode != fiber.StatusServiceUnavailable {
+			t.Errorf("got status %d; want %d", resp.StatusCode, fiber.StatusServiceUnavailable)
+		}
+	})
+}
+
+func TestMetricsHandlerErrorsCounter(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(failingCollector{})
+	app := newHandlerTestApp(registry, promhttp.HandlerOpts{Registry: registry, ErrorHandling: promhttp.ContinueOnError})
+	// Registering a second handler reuses the existing errors counter.
+	newMetricsHandler(registry, promhttp.HandlerOpts{Registry: registry})
+
+	app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	want := `promhttp_metric_handler_errors_total{cause="gathering"} 1`
+	if !strings.Contains(string(body), want) {
+		t.Errorf("got %s; want %s", body, want)
+	}
+}
@@ -0,0 +1,172 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/common/model"
+)
+
+// Metric identifies one of the metrics recorded by FiberPrometheus.
+type Metric int
+
+const (
+	// MetricRequestsTotal is the requests_total counter.
+	MetricRequestsTotal Metric = iota
+	// MetricRequestDuration is the request_duration_seconds histogram.
+	MetricRequestDuration
+	// MetricRequestsInFlight is the requests_in_progress_total gauge.
+	MetricRequestsInFlight
+	// MetricRequestSize is the request_size_bytes histogram.
+	MetricRequestSize
+	// MetricResponseSize is the response_size_bytes histogram.
+	MetricResponseSize
+	// MetricRequestDurationSummary is the request_duration_summary_seconds
+	// summary.
+	MetricRequestDurationSummary
+)
+
+// String returns the default name suffix of the metric.
+func (m Metric) String() string {
+	switch m {
+	case MetricRequestsTotal:
+		return "requests_total"
+	case MetricRequestDuration:
+		return "request_duration_seconds"
+	case MetricRequestsInFlight:
+		return "requests_in_progress_total"
+	case MetricRequestSize:
+		return "request_size_bytes"
+	case MetricResponseSize:
+		return "response_size_bytes"
+	case MetricRequestDurationSummary:
+		return "request_duration_summary_seconds"
+	default:
+		return fmt.Sprintf("Metric(%d)", int(m))
+	}
+}
+
+// MetricOpts overrides the defaults of one of the metrics.
+type MetricOpts struct {
+	// Name replaces the name of the metric, which is still prefixed with
+	// the Namespace and Subsystem.
+	//
+	// Optional. Default: the name given by the Naming, e.g. "requests_total"
+	Name string
+
+	// Help replaces the help text of the metric.
+	//
+	// Optional. Default: the help text given by the Naming
+	Help string
+
+	// Disable leaves the metric out, it is neither registered nor updated.
+	//
+	// Optional. Default: false
+	Disable bool
+}
+
+// requestMetrics are the metrics observed once the handler chain has run,
+// and which can therefore carry custom labels.
+var requestMetrics = []Metric{MetricRequestsTotal, MetricRequestDuration, MetricRequestSize, MetricResponseSize, MetricRequestDurationSummary}
+
+// allMetrics are the request metrics and the in-flight gauge.
+var allMetrics = []Metric{MetricRequestsTotal, MetricRequestDuration, MetricRequestsInFlight, MetricRequestSize, MetricResponseSize, MetricRequestDurationSummary}
+
+// Label is an additional variable label whose value is extracted from every
+// request.
+type Label struct {
+	// Name is the label name.
+	//
+	// Required.
+	Name string
+
+	// Extract returns the label value of a request. It runs after the rest
+	// of the handler chain, so values stored in c.Locals by downstream
+	// handlers are available. Keep the set of returned values small, every
+	// distinct value creates new series. Values taken from headers or other
+	// request data are chosen by the client, who can create any number of
+	// series: map them to a known set, or bound them with CardinalityLimit.
+	// Invalid UTF-8 is replaced with U+FFFD.
+	//
+	// Required.
+	Extract func(c *fiber.Ctx) string
+
+	// Metrics restricts the label to some of the metrics. The in-flight
+	// gauge is updated before the handler chain runs and cannot carry
+	// custom labels.
+	//
+	// Optional. Default: all metrics but the in-flight gauge
+	Metrics []Metric
+}
+
+// labelValue makes a value taken from a request usable as a label value,
+// which must be valid UTF-8.
+func labelValue(v string) string {
+	return strings.ToValidUTF8(v, "\uFFFD")
+}
+
+// appliesTo reports whether the label is attached to the given metric.
+func (l Label) appliesTo(m Metric) bool {
+	if len(l.Metrics) == 0 {
+		return true
+	}
+	for _, metric := range l.Metrics {
+		if metric == m {
+			return true
+		}
+	}
+	return false
+}
+
+// validateLabels checks the custom labels against each other and against the
+// labels the middleware already sets.
+func validateLabels(labels []Label, reserved map[string]bool) error {
+	seen := make(map[string]bool, len(labels))
+	for _, l := range labels {
+		if !model.LabelName(l.Name).IsValidLegacy() {
+			return fmt.Errorf("fiberprometheus: invalid label name %q", l.Name)
+		}
+		if reserved[l.Name] {
+			return fmt.Errorf("fiberprometheus: label %q collides with an existing label", l.Name)
+		}
+		if seen[l.Name] {
+			return fmt.Errorf("fiberprometheus: duplicate label %q", l.Name)
+		}
+		seen[l.Name] = true
+
+		if l.Extract == nil {
+			return fmt.Errorf("fiberprometheus: label %q has no Extract function", l.Name)
+		}
+		for _, m := range l.Metrics {
+			if m == MetricRequestsInFlight {
+				return fmt.Errorf("fiberprometheus: label %q cannot be added to %s", l.Name, m)
+			}
+			if m < MetricRequestsTotal || m > MetricRequestDurationSummary {
+				return fmt.Errorf("fiberprometheus: label %q refers to unknown %s", l.Name, m)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCustomLabels(t *testing.T) {
+	t.Parallel()
+
+	app := fiber.New()
+	prometheus, err := NewWithConfig(Config{
+		ServiceName: "labels-service",
+		Namespace:   "http",
+		Labels: []Label{
+			{
+				Name:    "tenant",
+				Extract: func(c *fiber.Ctx) string { return c.Get("X-Tenant", "none") },
+			},
+			{
+				Name: "api_version",
+				Extract: func(c *fiber.Ctx) string {
+					version, _ := c.Locals("api_version").(string)
+					return version
+				},
+				Metrics: []Metric{MetricRequestsTotal},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(prometheus.Middleware)
+
+	app.Get("/", func(c *fiber.Ctx) error {
+		c.Locals("api_version", "v2")
+		return c.SendString("Hello World")
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Tenant", "acme")
+	app.Test(req, -1)
+	app.Test(httptest.NewRequest("GET", "/", nil), -1)
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+
+	want := `http_requests_total{api_version="v2",method="GET",path="/",service="labels-service",status_code="200",tenant="acme"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	want = `http_requests_total{api_version="v2",method="GET",path="/",service="labels-service",status_code="200",tenant="none"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	want = `http_request_duration_seconds_count{method="GET",path="/",service="labels-service",status_code="200",tenant="acme"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	want = `http_requests_in_progress_total{method="GET",service="labels-service"} 0`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
+
+func TestCustomLabelsInvalidUTF8(t *testing.T) {
+	t.Parallel()
+
+	app := fiber.New()
+	prometheus, err := NewWithConfig(Config{
+		Labels: []Label{{Name: "tenant", Extract: func(c *fiber.Ctx) string { return c.Get("X-Tenant") }}},
+	})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(prometheus.Middleware)
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("Hello World") })
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Tenant", "a\xffb")
+	if _, err := app.Test(req, -1); err != nil {
+		t.Fatalf("request: %v", err)
+	}
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+
+	want := "requests_total{method=\"GET\",path=\"/\",status_code=\"200\",tenant=\"a\uFFFDb\"} 1"
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
+
+func TestCustomLabelsValidation(t *testing.T) {
+	t.Parallel()
+
+	extract := func(c *fiber.Ctx) string { return "" }
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "invalid name", cfg: Config{Labels: []Label{{Name: "api-version", Extract: extract}}}},
+		{name: "reserved name", cfg: Config{Labels: []Label{{Name: "method", Extract: extract}}}},
+		{name: "const label", cfg: Config{ConstLabels: map[string]string{"tenant": "x"}, Labels: []Label{{Name: "tenant", Extract: extract}}}},
+		{name: "duplicate", cfg: Config{Labels: []Label{{Name: "tenant", Extract: extract}, {Name: "tenant", Extract: extract}}}},
+		{name: "missing extractor", cfg: Config{Labels: []Label{{Name: "tenant"}}}},
+		{name: "in-flight gauge", cfg: Config{Labels: []Label{{Name: "tenant", Extract: extract, Metrics: []Metric{MetricRequestsInFlight}}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWithConfig(tt.cfg); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+// Unregister unregisters the collectors registered by this instance from the
+// registerer it was created with, so that a new instance can register them
+// again. Collectors reused from another instance with
+// Config.ReuseExistingCollectors are left registered. Calling Unregister
+// more than once is safe.
+func (ps *FiberPrometheus) Unregister() {
+	ps.collectorsMu.Lock()
+	defer ps.collectorsMu.Unlock()
+
+	for _, c := range ps.collectors {
+		ps.registerer.Unregister(c)
+	}
+	ps.collectors = nil
+}
+
+// Close unregisters the collectors like Unregister, stops expiring idle
+// series, shuts down the metrics server started by ListenAndServe or
+// StartMetricsServer and forgets the routes of the apps served so far.
+// Requests recorded after Close are no longer exposed. Calling Close more
+// than once is safe.
+func (ps *FiberPrometheus) Close() error {
+	ps.Unregister()
+	ps.stopOnce.Do(func() {
+		close(ps.stop)
+		ps.releaseTrackers()
+	})
+	err := ps.ShutdownMetricsServer()
+	ps.apps.Clear()
+	return err
+}
@@ -0,0 +1,111 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestUnregister(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	cfg := Config{Registerer: registry, EnableRequestSize: true, EnableResponseSize: true}
+
+	for i := 0; i < 3; i++ {
+		ps, err := NewWithConfig(cfg)
+		if err != nil {
+			t.Fatalf("NewWithConfig #%d: %v", i, err)
+		}
+		ps.requestsTotal.WithLabelValues("200", "GET", "/").Inc()
+		ps.Unregister()
+		ps.Unregister()
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	if len(families) != 0 {
+		t.Errorf("expected no collectors left, got %d families", len(families))
+	}
+}
+
+func TestUnregisterKeepsReusedCollectors(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	cfg := Config{Registerer: registry, ReuseExistingCollectors: true}
+
+	owner, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+	reuser, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+
+	reuser.Unregister()
+	owner.requestsTotal.WithLabelValues("200", "GET", "/").Inc()
+	if families, _ := registry.Gather(); len(families) == 0 {
+		t.Error("unregistering the reusing instance removed the shared collectors")
+	}
+
+	owner.Unregister()
+	if families, _ := registry.Gather(); len(families) != 0 {
+		t.Errorf("expected no collectors left, got %d families", len(families))
+	}
+}
+
+func TestClose(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	ps, err := NewWithConfig(Config{Registerer: registry})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+
+	addr := freeAddr(t)
+	if err := ps.StartMetricsServer(context.Background(), addr); err != nil {
+		t.Fatalf("StartMetricsServer: %v", err)
+	}
+
+	if err := ps.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := ps.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+
+	if _, err := http.Get("http://" + addr + "/metrics"); err == nil {
+		t.Error("expected the metrics server to be shut down")
+	}
+	if _, err := NewWithConfig(Config{Registerer: registry}); err != nil {
+		t.Errorf("NewWithConfig after Close: %v", err)
+	}
+}
@@ -22,16 +22,17 @@
 package fiberprometheus
 
 import (
+	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/gofiber/fiber/v2/log"
 	"github.com/gofiber/fiber/v2/utils"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"go.opentelemetry.io/otel/trace"
@@ -39,110 +40,356 @@ import (
 
 // FiberPrometheus ...
 type FiberPrometheus struct {
-	gatherer          prometheus.Gatherer
-	requestsTotal     *prometheus.CounterVec
-	requestDuration   *prometheus.HistogramVec
-	requestInFlight   *prometheus.GaugeVec
-	defaultURL        string
-	skipPaths         map[string]bool
-	ignoreStatusCodes map[int]bool
-	registeredRoutes  map[string]struct{}
-	routesOnce        sync.Once
+	registerer          prometheus.Registerer
+	collectorsMu        sync.Mutex
+	collectors          []prometheus.Collector
+	gatherer            prometheus.Gatherer
+	requestsTotal       *prometheus.CounterVec
+	requestDuration     *prometheus.HistogramVec
+	requestInFlight     *prometheus.GaugeVec
+	requestSize         *prometheus.HistogramVec
+	responseSize        *prometheus.HistogramVec
+	durationSummary     *prometheus.SummaryVec
+	scrapesTotal        *prometheus.CounterVec
+	scrapeDuration      prometheus.Histogram
+	scrapesInFlight     prometheus.Gauge
+	labels              []Label
+	extraLabels         map[Metric][]int
+	defaultURL          string
+	handlerOpts         promhttp.HandlerOpts
+	auth                fiber.Handler
+	next                func(c *fiber.Ctx) bool
+	skipRules           *skipRules
+	handleErrors        bool
+	errorStatus         func(c *fiber.Ctx, err error) int
+	recordUnmatched     bool
+	unmatchedPath       string
+	skipPaths           map[string]bool
+	ignoreStatusCodes   map[int]bool
+	initStatusCodes     []int
+	appLabel            bool
+	attributes          []attributeLabel
+	attributeIndexes    map[Metric][]int
+	lowercaseMethod     bool
+	bodySizesOnly       bool
+	apps                sync.Map // *fiber.App -> *appState
+	serverMu            sync.Mutex
+	server              *metricsServer
+	trackers            map[Metric]*seriesTracker
+	seriesEvicted       *prometheus.CounterVec
+	cardinalityExceeded *prometheus.CounterVec
+	overflowValues      map[Metric][]string
+	otel                *otelRecorder
+	usePrometheus       bool
+	stop                chan struct{}
+	stopOnce            sync.Once
 }
 
-func create(registry prometheus.Registerer, serviceName, namespace, subsystem string, labels map[string]string) *FiberPrometheus {
-	if registry == nil {
-		registry = prometheus.NewRegistry()
+func create(cfg Config) (*FiberPrometheus, error) {
+	rules, err := newSkipRules(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := newAuthHandler(cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	var otel *otelRecorder
+	if cfg.MeterProvider != nil {
+		if otel, err = newOtelRecorder(cfg.MeterProvider); err != nil {
+			return nil, fmt.Errorf("fiberprometheus: %w", err)
+		}
 	}
 
 	constLabels := make(prometheus.Labels)
-	if serviceName != "" {
-		constLabels["service"] = serviceName
+	if cfg.ServiceName != "" {
+		constLabels["service"] = cfg.ServiceName
 	}
-	for label, value := range labels {
+	for label, value := range cfg.ConstLabels {
 		constLabels[label] = value
 	}
 
-	counter := promauto.With(registry).NewCounterVec(
-		prometheus.CounterOpts{
-			Name:        prometheus.BuildFQName(namespace, subsystem, "requests_total"),
-			Help:        "Count all http requests by status code, method and path.",
-			ConstLabels: constLabels,
+	names := cfg.names()
+	attributes := attributeLabels(cfg)
+
+	// Custom labels follow the status code, method, path, app and attribute
+	// labels. The in-flight gauge only has the method, app and some
+	// attribute labels.
+	variableLabels := func(m Metric) []string {
+		if m == MetricRequestsInFlight {
+			labels := []string{names.method}
+			if cfg.AppLabel {
+				labels = append(labels, "app")
+			}
+			for _, a := range attributes {
+				if a.appliesTo(m) {
+					labels = append(labels, a.name)
+				}
+			}
+			return labels
+		}
+
+		labels := []string{names.status, names.method, names.path}
+		if cfg.AppLabel {
+			labels = append(labels, "app")
+		}
+		for _, a := range attributes {
+			if a.appliesTo(m) {
+				labels = append(labels, a.name)
+			}
+		}
+		for _, l := range cfg.Labels {
+			if l.appliesTo(m) {
+				labels = append(labels, l.Name)
+			}
+		}
+		return labels
+	}
+
+	var counter *prometheus.CounterVec
+	if cfg.enabled(MetricRequestsTotal) {
+		counter = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        prometheus.BuildFQName(cfg.Namespace, cfg.Subsystem, names.metrics[MetricRequestsTotal]),
+				Help:        names.help[MetricRequestsTotal],
+				ConstLabels: constLabels,
+			},
+			variableLabels(MetricRequestsTotal),
+		)
+	}
+
+	buckets := cfg.Buckets
+	if cfg.DisableClassicBuckets {
+		buckets = nil
+	}
+
+	var histogram *prometheus.HistogramVec
+	if cfg.enabled(MetricRequestDuration) {
+		histogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:                            prometheus.BuildFQName(cfg.Namespace, cfg.Subsystem, names.metrics[MetricRequestDuration]),
+			Help:                            names.help[MetricRequestDuration],
+			ConstLabels:                     constLabels,
+			Buckets:                         buckets,
+			NativeHistogramBucketFactor:     cfg.NativeHistogramBucketFactor,
+			NativeHistogramMaxBucketNumber:  cfg.NativeHistogramMaxBucketNumber,
+			NativeHistogramMinResetDuration: cfg.NativeHistogramMinResetDuration,
 		},
-		[]string{"status_code", "method", "path"},
-	)
+			variableLabels(MetricRequestDuration),
+		)
+	}
+
+	var gauge *prometheus.GaugeVec
+	if cfg.enabled(MetricRequestsInFlight) {
+		gauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:        prometheus.BuildFQName(cfg.Namespace, cfg.Subsystem, names.metrics[MetricRequestsInFlight]),
+			Help:        names.help[MetricRequestsInFlight],
+			ConstLabels: constLabels,
+		}, variableLabels(MetricRequestsInFlight))
+	}
 
-	histogram := promauto.With(registry).NewHistogramVec(prometheus.HistogramOpts{
-		Name:        prometheus.BuildFQName(namespace, subsystem, "request_duration_seconds"),
-		Help:        "Duration of all HTTP requests by status code, method and path.",
+	scrapesTotal := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        prometheus.BuildFQName(cfg.Namespace, cfg.Subsystem, "metrics_handler_requests_total"),
+		Help:        "Total number of scrapes of the metrics endpoint by HTTP status code.",
 		ConstLabels: constLabels,
-		Buckets: []float64{
-			0.000000001, // 1ns
-			0.000000002,
-			0.000000005,
-			0.00000001, // 10ns
-			0.00000002,
-			0.00000005,
-			0.0000001, // 100ns
-			0.0000002,
-			0.0000005,
-			0.000001, // 1µs
-			0.000002,
-			0.000005,
-			0.00001, // 10µs
-			0.00002,
-			0.00005,
-			0.0001, // 100µs
-			0.0002,
-			0.0005,
-			0.001, // 1ms
-			0.002,
-			0.005,
-			0.01, // 10ms
-			0.02,
-			0.05,
-			0.1, // 100 ms
-			0.2,
-			0.5,
-			1.0, // 1s
-			2.0,
-			5.0,
-			10.0, // 10s
-			15.0,
-			20.0,
-			30.0,
-			60.0, // 1m
-		},
-	},
-		[]string{"status_code", "method", "path"},
-	)
+	}, []string{"code"})
 
-	gauge := promauto.With(registry).NewGaugeVec(prometheus.GaugeOpts{
-		Name:        prometheus.BuildFQName(namespace, subsystem, "requests_in_progress_total"),
-		Help:        "All the requests in progress",
+	scrapeDuration := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:        prometheus.BuildFQName(cfg.Namespace, cfg.Subsystem, "metrics_handler_request_duration_seconds"),
+		Help:        "Duration of all scrapes of the metrics endpoint.",
 		ConstLabels: constLabels,
-	}, []string{"method"})
+		Buckets:     PrometheusDefaultBuckets,
+	})
 
-	// If the registerer is also a gatherer, use it, falling back to the
-	// DefaultGatherer.
-	gatherer, ok := registry.(prometheus.Gatherer)
-	if !ok {
-		gatherer = prometheus.DefaultGatherer
-	}
+	scrapesInFlight := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        prometheus.BuildFQName(cfg.Namespace, cfg.Subsystem, "metrics_handler_requests_in_flight"),
+		Help:        "Current number of scrapes of the metrics endpoint being served.",
+		ConstLabels: constLabels,
+	})
 
-	return &FiberPrometheus{
-		gatherer:        gatherer,
+	ps := &FiberPrometheus{
+		registerer:      cfg.Registerer,
+		stop:            make(chan struct{}),
+		gatherer:        cfg.Gatherer,
 		requestsTotal:   counter,
 		requestDuration: histogram,
 		requestInFlight: gauge,
+		scrapesTotal:    scrapesTotal,
+		scrapeDuration:  scrapeDuration,
+		scrapesInFlight: scrapesInFlight,
 		defaultURL:      "/metrics",
+		handlerOpts:     *cfg.HandlerOpts,
+		auth:            auth,
+		next:            cfg.Next,
+		skipRules:       rules,
+		handleErrors:    cfg.HandleErrors,
+		errorStatus:     cfg.ErrorStatus,
+		recordUnmatched: cfg.RecordUnmatchedRoutes,
+		unmatchedPath:   cfg.UnmatchedRoutePath,
+		labels:          cfg.Labels,
+		appLabel:        cfg.AppLabel,
+		initStatusCodes: cfg.InitStatusCodes,
+		attributes:      attributes,
+		lowercaseMethod: names.lowercaseMethod,
+		bodySizesOnly:   cfg.Naming == NamingOTel,
+		otel:            otel,
+		usePrometheus:   !cfg.DisablePrometheus,
+	}
+
+	if len(cfg.Labels) > 0 {
+		ps.extraLabels = make(map[Metric][]int)
+		for _, m := range requestMetrics {
+			for i, l := range cfg.Labels {
+				if l.appliesTo(m) {
+					ps.extraLabels[m] = append(ps.extraLabels[m], i)
+				}
+			}
+		}
+	}
+
+	if len(attributes) > 0 {
+		ps.attributeIndexes = make(map[Metric][]int)
+		for _, m := range requestMetrics {
+			for i, a := range attributes {
+				if a.appliesTo(m) {
+					ps.attributeIndexes[m] = append(ps.attributeIndexes[m], i)
+				}
+			}
+		}
+	}
+
+	if cfg.enabled(MetricRequestSize) {
+		ps.requestSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        prometheus.BuildFQName(cfg.Namespace, cfg.Subsystem, names.metrics[MetricRequestSize]),
+			Help:        names.help[MetricRequestSize],
+			ConstLabels: constLabels,
+			Buckets:     cfg.RequestSizeBuckets,
+		},
+			variableLabels(MetricRequestSize),
+		)
 	}
+
+	if cfg.enabled(MetricResponseSize) {
+		ps.responseSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        prometheus.BuildFQName(cfg.Namespace, cfg.Subsystem, names.metrics[MetricResponseSize]),
+			Help:        names.help[MetricResponseSize],
+			ConstLabels: constLabels,
+			Buckets:     cfg.ResponseSizeBuckets,
+		},
+			variableLabels(MetricResponseSize),
+		)
+	}
+
+	if cfg.enabled(MetricRequestDurationSummary) {
+		ps.durationSummary = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+			Name:        prometheus.BuildFQName(cfg.Namespace, cfg.Subsystem, names.metrics[MetricRequestDurationSummary]),
+			Help:        names.help[MetricRequestDurationSummary],
+			ConstLabels: constLabels,
+			Objectives:  cfg.SummaryObjectives,
+			MaxAge:      cfg.SummaryMaxAge,
+			AgeBuckets:  cfg.SummaryAgeBuckets,
+		},
+			variableLabels(MetricRequestDurationSummary),
+		)
+	}
+
+	if len(cfg.SkipPaths) > 0 {
+		ps.skipPaths = make(map[string]bool, len(cfg.SkipPaths))
+		for _, path := range cfg.SkipPaths {
+			ps.skipPaths[normalizePath(path)] = true
+		}
+	}
+
+	if len(cfg.IgnoreStatusCodes) > 0 {
+		ps.ignoreStatusCodes = make(map[int]bool, len(cfg.IgnoreStatusCodes))
+		for _, code := range cfg.IgnoreStatusCodes {
+			ps.ignoreStatusCodes[code] = true
+		}
+	}
+
+	if cfg.DisablePrometheus {
+		return ps, nil
+	}
+
+	r := &registrar{registerer: cfg.Registerer, reuse: cfg.ReuseExistingCollectors}
+	if ps.requestsTotal != nil {
+		register(r, &ps.requestsTotal)
+	}
+	if ps.requestDuration != nil {
+		register(r, &ps.requestDuration)
+	}
+	if ps.requestInFlight != nil {
+		register(r, &ps.requestInFlight)
+	}
+	register(r, &ps.scrapesTotal)
+	register(r, &ps.scrapeDuration)
+	register(r, &ps.scrapesInFlight)
+	if ps.requestSize != nil {
+		register(r, &ps.requestSize)
+	}
+	if ps.responseSize != nil {
+		register(r, &ps.responseSize)
+	}
+	if ps.durationSummary != nil {
+		register(r, &ps.durationSummary)
+	}
+	if cfg.SeriesTTL > 0 {
+		ps.seriesEvicted = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        prometheus.BuildFQName(cfg.Namespace, cfg.Subsystem, "series_evicted_total"),
+			Help:        "Total number of series deleted after being idle for longer than their TTL, by metric.",
+			ConstLabels: constLabels,
+		}, []string{"metric"})
+		register(r, &ps.seriesEvicted)
+	}
+	if cfg.CardinalityLimit > 0 || len(cfg.CardinalityLimits) > 0 {
+		ps.cardinalityExceeded = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        prometheus.BuildFQName(cfg.Namespace, cfg.Subsystem, "cardinality_limit_exceeded_total"),
+			Help:        "Total number of observations folded into the overflow series because the cardinality limit was reached, by metric.",
+			ConstLabels: constLabels,
+		}, []string{"metric"})
+		register(r, &ps.cardinalityExceeded)
+	}
+	if r.err != nil {
+		r.unregister()
+		return nil, r.err
+	}
+	if err := ps.initTrackers(cfg, variableLabels, r.reused); err != nil {
+		r.unregister()
+		return nil, err
+	}
+	ps.collectors = r.registered
+	if cfg.SeriesTTL > 0 {
+		go ps.runExpiry(cfg.SeriesTTL, cfg.SeriesExpiryInterval, ps.stop)
+	}
+
+	return ps, nil
+}
+
+// NewWithConfig creates a new instance of FiberPrometheus middleware from the
+// given config. The config is validated before any collector is registered.
+func NewWithConfig(config Config) (*FiberPrometheus, error) {
+	cfg := configDefault(config)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return create(cfg)
+}
+
+// mustNew backs the legacy constructors, which have no way to report an
+// invalid config or a failed registration other than panicking.
+func mustNew(cfg Config) *FiberPrometheus {
+	ps, err := NewWithConfig(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return ps
 }
 
 // New creates a new instance of FiberPrometheus middleware
 // serviceName is available as a const label
 func New(serviceName string) *FiberPrometheus {
-	return create(nil, serviceName, "http", "", nil)
+	return mustNew(Config{ServiceName: serviceName, Namespace: "http"})
 }
 
 // NewWith creates a new instance of FiberPrometheus middleware but with an ability
@@ -153,7 +400,7 @@ func New(serviceName string) *FiberPrometheus {
 // For e.g. namespace = "my_app", subsystem = "http" then metrics would be
 // `my_app_http_requests_total{...,service= "serviceName"}`
 func NewWith(serviceName, namespace, subsystem string) *FiberPrometheus {
-	return create(nil, serviceName, namespace, subsystem, nil)
+	return mustNew(Config{ServiceName: serviceName, Namespace: namespace, Subsystem: subsystem})
 }
 
 // NewWithLabels creates a new instance of FiberPrometheus middleware but with an ability
@@ -165,7 +412,7 @@ func NewWith(serviceName, namespace, subsystem string) *FiberPrometheus {
 // then then metrics would become
 // `my_app_http_requests_total{...,key1= "value1", key2= "value2" }`
 func NewWithLabels(labels map[string]string, namespace, subsystem string) *FiberPrometheus {
-	return create(nil, "", namespace, subsystem, labels)
+	return mustNew(Config{ConstLabels: labels, Namespace: namespace, Subsystem: subsystem})
 }
 
 // NewWithRegistry creates a new instance of FiberPrometheus middleware but with an ability
@@ -177,25 +424,87 @@ func NewWithLabels(labels map[string]string, namespace, subsystem string) *Fiber
 // then then metrics would become
 // `my_app_http_requests_total{...,key1= "value1", key2= "value2" }`
 func NewWithRegistry(registry prometheus.Registerer, serviceName, namespace, subsystem string, labels map[string]string) *FiberPrometheus {
-	return create(registry, serviceName, namespace, subsystem, labels)
+	return mustNew(Config{
+		Registerer:  registry,
+		ServiceName: serviceName,
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		ConstLabels: labels,
+	})
 }
 
 // NewWithDefaultRegistry creates a new instance of FiberPrometheus middleware using the default prometheus registry
 func NewWithDefaultRegistry(serviceName string) *FiberPrometheus {
-	return create(prometheus.DefaultRegisterer, serviceName, "http", "", nil)
+	return mustNew(Config{Registerer: prometheus.DefaultRegisterer, ServiceName: serviceName, Namespace: "http"})
 }
 
-// RegisterAt will register the prometheus handler at a given URL
+// RegisterAt will register the prometheus handler at a given URL, using
+// Config.HandlerOpts
+//
+// Scrapes of the URL are not recorded by the middleware, they are
+// instrumented by the dedicated metrics_handler_* metrics instead.
 func (ps *FiberPrometheus) RegisterAt(app fiber.Router, url string, handlers ...fiber.Handler) {
+	ps.RegisterAtWithOpts(app, url, ps.handlerOpts, handlers...)
+}
+
+// RegisterAtWithOpts will register the prometheus handler at a given URL,
+// like RegisterAt, but with the given handler options. Errors are logged to
+// Fiber's logger unless opts.ErrorLog is set. Config.Auth is checked before
+// the given handlers.
+func (ps *FiberPrometheus) RegisterAtWithOpts(app fiber.Router, url string, opts promhttp.HandlerOpts, handlers ...fiber.Handler) {
 	ps.defaultURL = url
 
-	h := append(handlers, adaptor.HTTPHandler(promhttp.HandlerFor(ps.gatherer, promhttp.HandlerOpts{
-		EnableOpenMetrics: true,
-	})))
+	if opts.ErrorLog == nil {
+		opts.ErrorLog = fiberLogger{}
+	}
+
+	h := make([]fiber.Handler, 0, len(handlers)+3)
+	h = append(h, ps.instrumentScrape)
+	if ps.auth != nil {
+		h = append(h, ps.auth)
+	}
+	h = append(h, handlers...)
+	h = append(h, newMetricsHandler(ps.gatherer, opts))
 	app.Get(ps.defaultURL, h...)
 }
 
+// fiberLogger adapts Fiber's logger to promhttp.Logger.
+type fiberLogger struct{}
+
+// Println implements promhttp.Logger.
+func (fiberLogger) Println(v ...interface{}) {
+	log.Error(v...)
+}
+
+// scrapeKey marks requests to the metrics endpoint in ctx.Locals.
+type scrapeKey struct{}
+
+// instrumentScrape records the scrape metrics and marks the request, so that
+// the middleware does not record it as regular traffic.
+func (ps *FiberPrometheus) instrumentScrape(ctx *fiber.Ctx) error {
+	ctx.Locals(scrapeKey{}, true)
+
+	// Export the initialized series of the app from its first scrape on
+	if len(ps.initStatusCodes) > 0 {
+		ps.app(ctx.App()).registeredRoutes(ctx.App())
+	}
+
+	ps.scrapesInFlight.Inc()
+	defer ps.scrapesInFlight.Dec()
+
+	start := time.Now()
+	err := ctx.Next()
+
+	ps.scrapesTotal.WithLabelValues(strconv.Itoa(ps.statusCode(ctx, err))).Inc()
+	ps.scrapeDuration.Observe(time.Since(start).Seconds())
+
+	return err
+}
+
 // SetSkipPaths allows to set the paths that should be skipped from the metrics
+//
+// Deprecated: SetSkipPaths is not safe to call once the middleware serves
+// requests, use Config.SkipPaths instead.
 func (ps *FiberPrometheus) SetSkipPaths(paths []string) {
 	if ps.skipPaths == nil {
 		ps.skipPaths = make(map[string]bool)
@@ -206,6 +515,9 @@ func (ps *FiberPrometheus) SetSkipPaths(paths []string) {
 }
 
 // SetIgnoreStatusCodes allows ignoring specific status codes from being recorded in metrics
+//
+// Deprecated: SetIgnoreStatusCodes is not safe to call once the middleware
+// serves requests, use Config.IgnoreStatusCodes instead.
 func (ps *FiberPrometheus) SetIgnoreStatusCodes(codes []int) {
 	if ps.ignoreStatusCodes == nil {
 		ps.ignoreStatusCodes = make(map[int]bool)
@@ -217,14 +529,53 @@ func (ps *FiberPrometheus) SetIgnoreStatusCodes(codes []int) {
 
 // Middleware is the actual default middleware implementation
 func (ps *FiberPrometheus) Middleware(ctx *fiber.Ctx) error {
+	// Don't execute middleware if Next returns true or a skip rule matches
+	if ps.next != nil && ps.next(ctx) {
+		return ctx.Next()
+	}
+	if ps.skipRules != nil && ps.skipRules.match(ctx) {
+		return ctx.Next()
+	}
+
 	// Retrieve the request method
 	method := utils.CopyString(ctx.Method())
 
+	// Look up what is tracked for the app serving the request
+	app := ps.app(ctx.App())
+
+	// Scrapes of the metrics endpoint are instrumented separately, and must
+	// not show up in the in-flight gauge
+	if app.registeredRoutes(ctx.App()).isScrape(ctx.App(), method, ctx.Path()) {
+		return ctx.Next()
+	}
+
+	// Resolve the method label value
+	methodValue := method
+	if ps.lowercaseMethod {
+		methodValue = strings.ToLower(method)
+	}
+
 	// Increment the in-flight gauge
-	ps.requestInFlight.WithLabelValues(method).Inc()
-	defer func() {
-		ps.requestInFlight.WithLabelValues(method).Dec()
-	}()
+	if ps.usePrometheus && ps.requestInFlight != nil {
+		inFlightValues := []string{methodValue}
+		if ps.appLabel {
+			inFlightValues = append(inFlightValues, app.name)
+		}
+		for _, a := range ps.attributes {
+			if a.appliesTo(MetricRequestsInFlight) {
+				inFlightValues = append(inFlightValues, labelValue(a.value(ctx, "")))
+			}
+		}
+		inFlight := ps.requestInFlight.WithLabelValues(ps.trackedValues(MetricRequestsInFlight, inFlightValues)...)
+		inFlight.Inc()
+		defer inFlight.Dec()
+	}
+
+	// Count the request as active in OpenTelemetry
+	scheme := ctx.Protocol()
+	if ps.otel != nil {
+		defer ps.otel.startRequest(ctx.UserContext(), method, scheme)()
+	}
 
 	// Start metrics timer
 	start := time.Now()
@@ -232,6 +583,19 @@ func (ps *FiberPrometheus) Middleware(ctx *fiber.Ctx) error {
 	// Continue stack
 	err := ctx.Next()
 
+	// Let the app's error handler produce the final response
+	if err != nil && ps.handleErrors {
+		if hErr := ctx.App().ErrorHandler(ctx, err); hErr != nil {
+			_ = ctx.SendStatus(fiber.StatusInternalServerError)
+		}
+		err = nil
+	}
+
+	// Scrapes of the metrics endpoint are instrumented separately
+	if ctx.Locals(scrapeKey{}) != nil {
+		return err
+	}
+
 	// Get the route path
 	routePath := utils.CopyString(ctx.Route().Path)
 
@@ -245,37 +609,23 @@ func (ps *FiberPrometheus) Middleware(ctx *fiber.Ctx) error {
 		routePath = normalizePath(routePath)
 	}
 
-	// Build registered routes map once
-	ps.routesOnce.Do(func() {
-		ps.registeredRoutes = make(map[string]struct{})
-		for _, r := range ctx.App().GetRoutes(true) {
-			p := r.Path
-			if p != "" && p != "/" {
-				p = normalizePath(p)
-			}
-			ps.registeredRoutes[r.Method+" "+p] = struct{}{}
+	// Skip metrics for routes that are not registered, or record them
+	// under the placeholder path
+	_, matched := app.registeredRoutes(ctx.App()).routes[method+" "+routePath]
+	if !matched {
+		if !ps.recordUnmatched {
+			return err
 		}
-	})
-
-	// Skip metrics for routes that are not registered
-	if _, ok := ps.registeredRoutes[method+" "+routePath]; !ok {
-		return err
+		routePath = ps.unmatchedPath
 	}
 
 	// Check if the normalized path should be skipped
 	if ps.skipPaths[routePath] {
-		return nil
+		return err
 	}
 
 	// Determine status code from stack
-	status := fiber.StatusInternalServerError
-	if err != nil {
-		if e, ok := err.(*fiber.Error); ok {
-			status = e.Code
-		}
-	} else {
-		status = ctx.Response().StatusCode()
-	}
+	status := ps.statusCode(ctx, err)
 
 	// Convert status code to string
 	statusCode := strconv.Itoa(status)
@@ -285,26 +635,136 @@ func (ps *FiberPrometheus) Middleware(ctx *fiber.Ctx) error {
 		return err
 	}
 
+	// Resolve the label values shared by all request metrics
+	values := ps.labelValues(ctx, app, statusCode, methodValue, routePath)
+
+	if ps.otel != nil {
+		otelRoute := routePath
+		if !matched {
+			otelRoute = ""
+		}
+		ps.recordOtelDuration(ctx, status, method, scheme, otelRoute, values, time.Since(start).Seconds())
+	}
+	if !ps.usePrometheus {
+		return err
+	}
+
 	// Update metrics
-	ps.requestsTotal.WithLabelValues(statusCode, method, routePath).Inc()
+	if ps.requestsTotal != nil {
+		ps.requestsTotal.WithLabelValues(ps.seriesValues(MetricRequestsTotal, values)...).Inc()
+	}
+
+	// Observe the request and response sizes
+	if ps.requestSize != nil {
+		size := requestSize(ctx)
+		if ps.bodySizesOnly {
+			size = requestBodySize(ctx)
+		}
+		ps.requestSize.WithLabelValues(ps.seriesValues(MetricRequestSize, values)...).Observe(float64(size))
+	}
+	if ps.responseSize != nil {
+		if size, ok := responseSize(ctx); ok {
+			ps.responseSize.WithLabelValues(ps.seriesValues(MetricResponseSize, values)...).Observe(float64(size))
+		}
+	}
 
 	// Observe the Request Duration
 	elapsed := float64(time.Since(start).Nanoseconds()) / 1e9
 
 	traceID := trace.SpanContextFromContext(ctx.UserContext()).TraceID()
-	histogram := ps.requestDuration.WithLabelValues(statusCode, method, routePath)
+	if ps.requestDuration != nil {
+		observeDuration(ps.requestDuration.WithLabelValues(ps.seriesValues(MetricRequestDuration, values)...), elapsed, traceID)
+	}
+	if ps.durationSummary != nil {
+		observeDuration(ps.durationSummary.WithLabelValues(ps.seriesValues(MetricRequestDurationSummary, values)...), elapsed, traceID)
+	}
 
+	return err
+}
+
+// observeDuration observes the request duration, with the trace ID as
+// exemplar if the request is traced and the observer supports exemplars.
+func observeDuration(observer prometheus.Observer, elapsed float64, traceID trace.TraceID) {
 	if traceID.IsValid() {
-		if histogramExemplar, ok := histogram.(prometheus.ExemplarObserver); ok {
-			histogramExemplar.ObserveWithExemplar(elapsed, prometheus.Labels{"traceID": traceID.String()})
+		if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok {
+			exemplarObserver.ObserveWithExemplar(elapsed, prometheus.Labels{"traceID": traceID.String()})
+			return
 		}
+	}
 
-		return err
+	observer.Observe(elapsed)
+}
+
+// statusCode resolves the status code the client receives for the outcome of
+// the handler chain.
+func (ps *FiberPrometheus) statusCode(ctx *fiber.Ctx, err error) int {
+	if err == nil {
+		return ctx.Response().StatusCode()
 	}
 
-	histogram.Observe(elapsed)
+	if ps.errorStatus != nil {
+		if code := ps.errorStatus(ctx, err); code != 0 {
+			return code
+		}
+	}
 
-	return err
+	var e *fiber.Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return fiber.StatusInternalServerError
+}
+
+// labelValues holds the variable label values of a single request.
+type labelValues struct {
+	base             []string
+	attributes       []string
+	extra            []string
+	attributeIndexes map[Metric][]int
+	extraLabels      map[Metric][]int
+}
+
+// labelValues evaluates the attribute and custom label extractors once for
+// all metrics.
+func (ps *FiberPrometheus) labelValues(ctx *fiber.Ctx, app *appState, statusCode, method, routePath string) labelValues {
+	values := labelValues{
+		base:             []string{statusCode, method, routePath},
+		attributeIndexes: ps.attributeIndexes,
+		extraLabels:      ps.extraLabels,
+	}
+	if ps.appLabel {
+		values.base = append(values.base, app.name)
+	}
+	if len(ps.attributes) > 0 {
+		values.attributes = make([]string, len(ps.attributes))
+		for i, a := range ps.attributes {
+			values.attributes[i] = labelValue(a.value(ctx, routePath))
+		}
+	}
+	if len(ps.labels) > 0 {
+		values.extra = make([]string, len(ps.labels))
+		for i, l := range ps.labels {
+			values.extra[i] = labelValue(utils.CopyString(l.Extract(ctx)))
+		}
+	}
+	return values
+}
+
+// of returns the label values of the given metric, in label name order.
+func (lv labelValues) of(m Metric) []string {
+	attributes, extras := lv.attributeIndexes[m], lv.extraLabels[m]
+	if len(attributes) == 0 && len(extras) == 0 {
+		return lv.base
+	}
+	values := make([]string, len(lv.base), len(lv.base)+len(attributes)+len(extras))
+	copy(values, lv.base)
+	for _, i := range attributes {
+		values = append(values, lv.attributes[i])
+	}
+	for _, i := range extras {
+		values = append(values, lv.extra[i])
+	}
+	return values
 }
 
 // normalizePath will remove the trailing slash from the route path
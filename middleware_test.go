@@ -23,6 +23,7 @@ package fiberprometheus
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http/httptest"
@@ -555,6 +556,84 @@ func TestMiddlewareWithBasicAuth(t *testing.T) {
 	}
 }
 
+// TestMetricsEndpointInstrumentation verifies that scrapes are excluded from
+// the request metrics and recorded by the dedicated scrape metrics instead.
+func TestMetricsEndpointInstrumentation(t *testing.T) {
+	t.Parallel()
+
+	app := fiber.New()
+	prometheus := New("scrapes")
+	prometheus.RegisterAt(app, "/metrics", basicauth.New(basicauth.Config{
+		Users: map[string]string{
+			"prometheus": "password",
+		},
+	}))
+	app.Use(prometheus.Middleware)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	resp, _ := app.Test(req, -1)
+	if resp.StatusCode != 401 {
+		t.Fatalf("Expected status 401, got %d", resp.StatusCode)
+	}
+
+	req.SetBasicAuth("prometheus", "password")
+	app.Test(req, -1)
+	resp, _ = app.Test(req, -1)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+
+	if strings.Contains(got, `path="/metrics"`) {
+		t.Errorf("scrapes should not be recorded as requests: %s", got)
+	}
+
+	want := `http_metrics_handler_requests_total{code="200",service="scrapes"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	want = `http_metrics_handler_requests_total{code="401",service="scrapes"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	want = `http_metrics_handler_request_duration_seconds_count{service="scrapes"} 2`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	want = `http_metrics_handler_requests_in_flight{service="scrapes"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
+
+// TestMetricsEndpointInFlight verifies that a scrape does not count itself
+// as a request in progress, whatever path form reaches the endpoint.
+func TestMetricsEndpointInFlight(t *testing.T) {
+	t.Parallel()
+
+	app := fiber.New()
+	prometheus := New("x")
+	app.Use(prometheus.Middleware)
+	prometheus.RegisterAt(app.Group("/internal"), "/metrics")
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("Hello World") })
+
+	app.Test(httptest.NewRequest("GET", "/", nil), -1)
+
+	for _, path := range []string{"/internal/metrics", "/internal/Metrics/"} {
+		resp, _ := app.Test(httptest.NewRequest("GET", path, nil), -1)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		got := string(body)
+
+		want := `http_requests_in_progress_total{method="GET",service="x"} 0`
+		if !strings.Contains(got, want) {
+			t.Errorf("%s: got %s; want %s", path, got, want)
+		}
+	}
+}
+
 func TestMiddlewareWithCustomRegistry(t *testing.T) {
 	t.Parallel()
 
@@ -659,6 +738,99 @@ func TestCustomRegistryRegisterAt(t *testing.T) {
 	}
 }
 
+// failingCollector always fails to collect, making every gather fail.
+type failingCollector struct{}
+
+func (failingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- prometheus.NewDesc("failing_metric", "Always fails.", nil, nil)
+}
+
+func (failingCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("failing_metric", "Always fails.", nil, nil), errors.New("collect failed"))
+}
+
+// recordingLogger records the messages logged by the metrics handler.
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) Println(v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, fmt.Sprint(v...))
+}
+
+func TestRegisterAtWithOpts(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		handling   promhttp.HandlerErrorHandling
+		wantStatus int
+	}{
+		{name: "http error on error", handling: promhttp.HTTPErrorOnError, wantStatus: fiber.StatusInternalServerError},
+		{name: "continue on error", handling: promhttp.ContinueOnError, wantStatus: fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(failingCollector{})
+			logger := &recordingLogger{}
+
+			app := fiber.New()
+			promfiber := NewWithRegistry(registry, "handler-opts", "http", "", nil)
+			promfiber.RegisterAtWithOpts(app, "/metrics", promhttp.HandlerOpts{
+				ErrorLog:           logger,
+				ErrorHandling:      tt.handling,
+				DisableCompression: true,
+			})
+			app.Use(promfiber.Middleware)
+
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			resp, _ := app.Test(req, -1)
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+			if encoding := resp.Header.Get("Content-Encoding"); encoding != "" {
+				t.Errorf("Expected no compression, got %q", encoding)
+			}
+
+			logger.mu.Lock()
+			defer logger.mu.Unlock()
+			if len(logger.messages) == 0 || !strings.Contains(logger.messages[0], "collect failed") {
+				t.Errorf("Expected the gather error to be logged, got %v", logger.messages)
+			}
+		})
+	}
+}
+
+func TestHandlerOptsFromConfig(t *testing.T) {
+	t.Parallel()
+
+	app := fiber.New()
+	promfiber, err := NewWithConfig(Config{
+		HandlerOpts: &promhttp.HandlerOpts{EnableOpenMetrics: false},
+	})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+	promfiber.RegisterAt(app, "/metrics")
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text")
+	resp, _ := app.Test(req, -1)
+	if contentType := resp.Header.Get("Content-Type"); strings.HasPrefix(contentType, "application/openmetrics-text") {
+		t.Errorf("Expected OpenMetrics to be disabled, got %q", contentType)
+	}
+
+	if _, err := NewWithConfig(Config{HandlerOpts: &promhttp.HandlerOpts{MaxRequestsInFlight: -1}}); err == nil {
+		t.Error("expected an error for a negative MaxRequestsInFlight")
+	}
+}
+
 // TestInFlightGauge verifies that the in-flight requests gauge is updated correctly.
 func TestInFlightGauge(t *testing.T) {
 	app := fiber.New()
@@ -699,15 +871,14 @@ func TestInFlightGauge(t *testing.T) {
 	body, _ := io.ReadAll(resp.Body)
 	got := string(body)
 
-	// The in-flight gauge should be equal to the number of concurrent requests
-	// Since requests are sleeping, some may have completed, so we check for at least one
-	if !strings.Contains(got, `http_requests_in_progress_total{method="GET",service="inflight-service"} 1`) {
-		t.Errorf("Expected in-flight gauge to be at least 1, got %s", got)
+	// The scrape itself is not counted as a request in progress
+	if !strings.Contains(got, `http_requests_in_progress_total{method="GET",service="inflight-service"} 0`) {
+		t.Errorf("Expected in-flight gauge to be 0, got %s", got)
 	}
 
 	want := `http_requests_total{method="GET",path="/long",service="inflight-service",status_code="200"} 10`
 	if !strings.Contains(got, want) {
-		t.Errorf("Expected in-flight gauge to be 0, got %s", got)
+		t.Errorf("got %s; want %s", got, want)
 	}
 }
 
@@ -867,6 +1038,88 @@ func TestMetricsAfterError(t *testing.T) {
 	}
 }
 
+// errConflict is a domain error mapped to 409 by the app's error handler
+var errConflict = errors.New("conflict")
+
+// TestErrorStatusResolution verifies that the recorded status code matches
+// what the app's error handler sends for non-fiber errors.
+func TestErrorStatusResolution(t *testing.T) {
+	t.Parallel()
+
+	errorHandler := func(c *fiber.Ctx, err error) error {
+		if errors.Is(err, errConflict) {
+			return c.Status(fiber.StatusConflict).SendString(err.Error())
+		}
+		return fiber.DefaultErrorHandler(c, err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{
+			name: "error status mapper",
+			cfg: Config{ErrorStatus: func(c *fiber.Ctx, err error) int {
+				if errors.Is(err, errConflict) {
+					return fiber.StatusConflict
+				}
+				return 0
+			}},
+		},
+		{name: "handle errors", cfg: Config{HandleErrors: true, EnableResponseSize: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New(fiber.Config{ErrorHandler: errorHandler})
+			tt.cfg.ServiceName = "error-status"
+			tt.cfg.Namespace = "http"
+			prometheus, err := NewWithConfig(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewWithConfig: %v", err)
+			}
+			prometheus.RegisterAt(app, "/metrics")
+			app.Use(prometheus.Middleware)
+
+			app.Get("/conflict", func(c *fiber.Ctx) error {
+				return fmt.Errorf("saving: %w", errConflict)
+			})
+			app.Get("/wrapped", func(c *fiber.Ctx) error {
+				return fmt.Errorf("lookup: %w", fiber.ErrNotFound)
+			})
+			app.Get("/unknown", func(c *fiber.Ctx) error {
+				return errors.New("boom")
+			})
+
+			resp, _ := app.Test(httptest.NewRequest("GET", "/conflict", nil), -1)
+			if resp.StatusCode != fiber.StatusConflict {
+				t.Fatalf("Expected status 409, got %d", resp.StatusCode)
+			}
+			app.Test(httptest.NewRequest("GET", "/wrapped", nil), -1)
+			app.Test(httptest.NewRequest("GET", "/unknown", nil), -1)
+
+			resp, _ = app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			got := string(body)
+
+			wants := []string{
+				`http_requests_total{method="GET",path="/conflict",service="error-status",status_code="409"} 1`,
+				`http_requests_total{method="GET",path="/wrapped",service="error-status",status_code="404"} 1`,
+				`http_requests_total{method="GET",path="/unknown",service="error-status",status_code="500"} 1`,
+			}
+			if tt.cfg.HandleErrors {
+				wants = append(wants, `http_response_size_bytes_sum{method="GET",path="/conflict",service="error-status",status_code="409"} 16`)
+			}
+			for _, want := range wants {
+				if !strings.Contains(got, want) {
+					t.Errorf("got %s; want %s", got, want)
+				}
+			}
+		})
+	}
+}
+
 // TestMultipleRegistrations ensures that calling RegisterAt multiple times does not duplicate handlers.
 func TestMultipleRegistrations(t *testing.T) {
 	app := fiber.New()
@@ -1078,6 +1331,103 @@ func TestSkipUnregisteredRouteWithGroup(t *testing.T) {
 	}
 }
 
+// TestRoutesAddedAfterFirstRequest verifies that routes registered once the
+// app is serving are recorded too.
+func TestRoutesAddedAfterFirstRequest(t *testing.T) {
+	t.Parallel()
+
+	app := fiber.New()
+	prometheus := New("late-routes")
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(prometheus.Middleware)
+
+	app.Get("/early", func(c *fiber.Ctx) error { return c.SendString("OK") })
+	app.Test(httptest.NewRequest("GET", "/early", nil), -1)
+
+	app.Get("/late", func(c *fiber.Ctx) error { return c.SendString("OK") })
+	app.Group("/plugin").Get("/:id", func(c *fiber.Ctx) error { return c.SendString("OK") })
+	app.Test(httptest.NewRequest("GET", "/late", nil), -1)
+	app.Test(httptest.NewRequest("GET", "/plugin/42", nil), -1)
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+
+	for _, path := range []string{"/early", "/late", "/plugin/:id"} {
+		want := `http_requests_total{method="GET",path="` + path + `",service="late-routes",status_code="200"} 1`
+		if !strings.Contains(got, want) {
+			t.Errorf("got %s; want %s", got, want)
+		}
+	}
+}
+
+func TestRecordUnmatchedRoutes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "default placeholder", want: "<unmatched>"},
+		{name: "custom placeholder", path: "__unknown__", want: "__unknown__"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			prometheus, err := NewWithConfig(Config{
+				ServiceName:           "unmatched",
+				Namespace:             "http",
+				RecordUnmatchedRoutes: true,
+				UnmatchedRoutePath:    tt.path,
+			})
+			if err != nil {
+				t.Fatalf("NewWithConfig: %v", err)
+			}
+			prometheus.RegisterAt(app, "/metrics")
+			app.Use(prometheus.Middleware)
+
+			app.Get("/registered", func(c *fiber.Ctx) error { return c.SendString("OK") })
+
+			app.Test(httptest.NewRequest("GET", "/registered", nil), -1)
+			app.Test(httptest.NewRequest("GET", "/not-found", nil), -1)
+			app.Test(httptest.NewRequest("GET", "/wp-login.php", nil), -1)
+			app.Test(httptest.NewRequest("POST", "/registered", nil), -1)
+
+			resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			got := string(body)
+
+			want := `http_requests_total{method="GET",path="/registered",service="unmatched",status_code="200"} 1`
+			if !strings.Contains(got, want) {
+				t.Errorf("got %s; want %s", got, want)
+			}
+
+			want = `http_requests_total{method="GET",path="` + tt.want + `",service="unmatched",status_code="404"} 2`
+			if !strings.Contains(got, want) {
+				t.Errorf("got %s; want %s", got, want)
+			}
+
+			want = `http_requests_total{method="POST",path="` + tt.want + `",service="unmatched",status_code="405"} 1`
+			if !strings.Contains(got, want) {
+				t.Errorf("got %s; want %s", got, want)
+			}
+
+			want = `http_request_duration_seconds_count{method="GET",path="` + tt.want + `",service="unmatched",status_code="404"} 2`
+			if !strings.Contains(got, want) {
+				t.Errorf("got %s; want %s", got, want)
+			}
+
+			if strings.Contains(got, "/not-found") || strings.Contains(got, "/wp-login.php") {
+				t.Errorf("unmatched paths must not be used as label values: %s", got)
+			}
+		})
+	}
+}
+
 func Benchmark_Middleware(b *testing.B) {
 	app := fiber.New()
 
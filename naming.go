@@ -0,0 +1,242 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// Naming selects the names of the metrics and of their standard labels.
+type Naming int
+
+const (
+	// NamingDefault uses the historical names, e.g.
+	// request_duration_seconds{status_code, method, path}.
+	NamingDefault Naming = iota
+	// NamingOTel uses the names the OpenTelemetry HTTP semantic conventions
+	// get when exported to Prometheus, like otelhttp does, e.g.
+	// http_server_request_duration_seconds{http_response_status_code,
+	// http_request_method, http_route}. The request sizes are named
+	// http_server_request_body_size_bytes and
+	// http_server_response_body_size_bytes and measure the bodies only. The
+	// conventions have no request counter, requests_total is named
+	// http_server_requests_total.
+	NamingOTel
+	// NamingEcho reproduces echo-contrib/echoprometheus: requests_total,
+	// request_duration_seconds, request_size_bytes and response_size_bytes
+	// labeled {code, method, host, url}, with its help texts and buckets.
+	// The host label holds the client's Host header, so its cardinality is
+	// unbounded and chosen by the client, unlike the url label of unmatched
+	// requests; bound it with CardinalityLimit. Set Subsystem to "echo" to
+	// get its default prefix.
+	NamingEcho
+	// NamingGin reproduces zsais/go-gin-prometheus: requests_total{code,
+	// method, handler, host, url} and request_duration_seconds{code, method,
+	// url}, with its help texts and buckets. The handler label holds the
+	// route name, or the route path of unnamed routes. The size histograms
+	// are labeled {code, method, url}. As with NamingEcho, the host label
+	// holds the client's Host header and its cardinality is unbounded. Set
+	// Subsystem to "gin" to get the usual prefix.
+	NamingGin
+	// NamingPromhttp follows the promhttp.InstrumentHandler* conventions:
+	// http_requests_total, http_request_duration_seconds,
+	// http_requests_in_flight, http_request_size_bytes and
+	// http_response_size_bytes labeled {code, method, handler}, with
+	// lowercase method values and the default buckets of the Prometheus
+	// client.
+	NamingPromhttp
+)
+
+// echoSizeBuckets are the size buckets of echoprometheus, from 1KiB to
+// 10MiB.
+var echoSizeBuckets = []float64{1 << 10, 2 << 10, 5 << 10, 10 << 10, 100 << 10, 500 << 10, 1 << 20, 2.5 * (1 << 20), 5 << 20, 10 << 20}
+
+// metricNames are the names of the metrics and standard labels of a Naming,
+// and the defaults that go with them.
+type metricNames struct {
+	metrics         map[Metric]string
+	help            map[Metric]string
+	status          string
+	method          string
+	path            string
+	lowercaseMethod bool
+	attributes      []attributeLabel // labels the naming always adds
+	buckets         []float64        // nil for the configured defaults
+	sizeBuckets     []float64
+}
+
+func (n Naming) names() metricNames {
+	names := metricNames{
+		metrics: make(map[Metric]string, len(allMetrics)),
+		help: map[Metric]string{
+			MetricRequestsTotal:          "Count all http requests by status code, method and path.",
+			MetricRequestDuration:        "Duration of all HTTP requests by status code, method and path.",
+			MetricRequestsInFlight:       "All the requests in progress",
+			MetricRequestSize:            "Size of all HTTP requests by status code, method and path.",
+			MetricResponseSize:           "Size of all HTTP responses by status code, method and path.",
+			MetricRequestDurationSummary: "Quantiles of the duration of all HTTP requests by status code, method and path.",
+		},
+		status: "status_code",
+		method: "method",
+		path:   "path",
+	}
+	for _, m := range allMetrics {
+		names.metrics[m] = m.String()
+	}
+
+	switch n {
+	case NamingOTel:
+		names.metrics = map[Metric]string{
+			MetricRequestsTotal:          "http_server_requests_total",
+			MetricRequestDuration:        "http_server_request_duration_seconds",
+			MetricRequestsInFlight:       "http_server_active_requests",
+			MetricRequestSize:            "http_server_request_body_size_bytes",
+			MetricResponseSize:           "http_server_response_body_size_bytes",
+			MetricRequestDurationSummary: "http_server_request_duration_summary_seconds",
+		}
+		names.status, names.method, names.path = "http_response_status_code", "http_request_method", "http_route"
+	case NamingEcho, NamingGin:
+		names.help[MetricRequestsTotal] = "How many HTTP requests processed, partitioned by status code and HTTP method."
+		names.help[MetricRequestDuration] = "The HTTP request latencies in seconds."
+		names.help[MetricRequestSize] = "The HTTP request sizes in bytes."
+		names.help[MetricResponseSize] = "The HTTP response sizes in bytes."
+		names.status, names.path = "code", "url"
+		names.buckets = PrometheusDefaultBuckets
+		host := attributeLabel{
+			name:    "host",
+			value:   func(c *fiber.Ctx, _ string) string { return utils.CopyString(c.Hostname()) },
+			metrics: requestMetrics,
+		}
+		if n == NamingEcho {
+			names.sizeBuckets = echoSizeBuckets
+			names.attributes = []attributeLabel{host}
+			break
+		}
+		host.metrics = []Metric{MetricRequestsTotal}
+		handler := attributeLabel{
+			name: "handler",
+			value: func(c *fiber.Ctx, routePath string) string {
+				if name := c.Route().Name; name != "" {
+					return utils.CopyString(name)
+				}
+				return routePath
+			},
+			metrics: []Metric{MetricRequestsTotal},
+		}
+		names.attributes = []attributeLabel{handler, host}
+	case NamingPromhttp:
+		for _, m := range allMetrics {
+			names.metrics[m] = "http_" + m.String()
+		}
+		names.metrics[MetricRequestsInFlight] = "http_requests_in_flight"
+		names.status, names.path = "code", "handler"
+		names.lowercaseMethod = true
+		names.buckets = PrometheusDefaultBuckets
+	}
+	return names
+}
+
+// names returns the names given by the Naming of the config, with the
+// overrides of Metrics and of the label names applied.
+func (cfg Config) names() metricNames {
+	names := cfg.Naming.names()
+	for m, opts := range cfg.Metrics {
+		if opts.Name != "" {
+			names.metrics[m] = opts.Name
+		}
+		if opts.Help != "" {
+			names.help[m] = opts.Help
+		}
+	}
+	if cfg.StatusCodeLabel != "" {
+		names.status = cfg.StatusCodeLabel
+	}
+	if cfg.MethodLabel != "" {
+		names.method = cfg.MethodLabel
+	}
+	if cfg.PathLabel != "" {
+		names.path = cfg.PathLabel
+	}
+	return names
+}
+
+// attributeLabel is a standard label taken from the request, added by the
+// naming or by the config. value is passed the path label value of the
+// request, which is empty for the in-flight gauge.
+type attributeLabel struct {
+	name    string
+	value   func(c *fiber.Ctx, routePath string) string
+	metrics []Metric // the metrics carrying the label
+}
+
+// appliesTo reports whether the label is attached to the given metric.
+func (a attributeLabel) appliesTo(m Metric) bool {
+	for _, metric := range a.metrics {
+		if metric == m {
+			return true
+		}
+	}
+	return false
+}
+
+// attributeLabels returns the attribute labels of the naming and those
+// enabled by the config, in label order.
+func attributeLabels(cfg Config) []attributeLabel {
+	labels := cfg.Naming.names().attributes
+	if cfg.ServerAddressLabel {
+		labels = append(labels, attributeLabel{
+			name:    "server_address",
+			value:   func(c *fiber.Ctx, _ string) string { return serverAddress(c.Hostname()) },
+			metrics: allMetrics,
+		})
+	}
+	if cfg.URLSchemeLabel {
+		labels = append(labels, attributeLabel{
+			name:    "url_scheme",
+			value:   func(c *fiber.Ctx, _ string) string { return utils.CopyString(c.Protocol()) },
+			metrics: allMetrics,
+		})
+	}
+	if cfg.NetworkProtocolVersionLabel {
+		labels = append(labels, attributeLabel{
+			name: "network_protocol_version",
+			value: func(c *fiber.Ctx, _ string) string {
+				return strings.TrimPrefix(string(c.Request().Header.Protocol()), "HTTP/")
+			},
+			metrics: requestMetrics,
+		})
+	}
+	return labels
+}
+
+// serverAddress returns the host of a Host header without its port, as the
+// server.address attribute expects.
+func serverAddress(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return utils.CopyString(h)
+	}
+	return utils.CopyString(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"))
+}
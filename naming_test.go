@@ -0,0 +1,247 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestNamingOTel(t *testing.T) {
+	t.Parallel()
+
+	ps, err := NewWithConfig(Config{
+		Naming:                      NamingOTel,
+		ServerAddressLabel:          true,
+		URLSchemeLabel:              true,
+		NetworkProtocolVersionLabel: true,
+		EnableRequestSize:           true,
+	})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+
+	app := fiber.New()
+	ps.RegisterAt(app, "/metrics")
+	app.Use(ps.Middleware)
+	app.Post("/users/:id", func(c *fiber.Ctx) error { return c.SendString("user") })
+
+	req := httptest.NewRequest("POST", "/users/1", strings.NewReader("12345"))
+	req.Host = "example.com:8080"
+	app.Test(req, -1)
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+
+	labels := `http_request_method="POST",http_response_status_code="200",http_route="/users/:id",network_protocol_version="1.1",server_address="example.com",url_scheme="http"`
+	for _, want := range []string{
+		`http_server_requests_total{` + labels + `} 1`,
+		`http_server_request_duration_seconds_count{` + labels + `} 1`,
+		`http_server_request_body_size_bytes_sum{` + labels + `} 5`,
+		`http_server_active_requests{http_request_method="POST",server_address="example.com",url_scheme="http"} 0`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %s; want %s", got, want)
+		}
+	}
+}
+
+func TestNamingInvalidHost(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name string
+		cfg  Config
+		want []string
+	}{
+		{
+			name: "server_address",
+			cfg:  Config{ServerAddressLabel: true},
+			want: []string{
+				"requests_total{method=\"GET\",path=\"/\",server_address=\"a\uFFFDb\",status_code=\"200\"} 1",
+				"requests_in_progress_total{method=\"GET\",server_address=\"a\uFFFDb\"} 0",
+			},
+		},
+		{
+			name: "echo",
+			cfg:  Config{Naming: NamingEcho},
+			want: []string{
+				"requests_total{code=\"200\",host=\"a\uFFFDb\",method=\"GET\",url=\"/\"} 1",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ps, err := NewWithConfig(tc.cfg)
+			if err != nil {
+				t.Fatalf("NewWithConfig: %v", err)
+			}
+
+			app := fiber.New()
+			ps.RegisterAt(app, "/metrics")
+			app.Use(ps.Middleware)
+			app.Get("/", func(c *fiber.Ctx) error { return c.SendString("Hello World") })
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Host = "a\xffb"
+			if _, err := app.Test(req, -1); err != nil {
+				t.Fatalf("request: %v", err)
+			}
+
+			resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			got := string(body)
+
+			for _, want := range tc.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("got %s; want %s", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNamingValidation(t *testing.T) {
+	t.Parallel()
+
+	for _, cfg := range []Config{
+		{Naming: Naming(42)},
+		{Naming: NamingOTel, ConstLabels: map[string]string{"http_route": "x"}},
+		{URLSchemeLabel: true, Labels: []Label{{Name: "url_scheme", Extract: func(*fiber.Ctx) string { return "" }}}},
+	} {
+		if _, err := NewWithConfig(cfg); err == nil {
+			t.Errorf("expected an error for %+v", cfg)
+		}
+	}
+}
+
+func TestNamingProfiles(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name      string
+		naming    Naming
+		subsystem string
+		want      []string
+	}{
+		{
+			name:      "echo",
+			naming:    NamingEcho,
+			subsystem: "echo",
+			want: []string{
+				`# HELP echo_requests_total How many HTTP requests processed, partitioned by status code and HTTP method.`,
+				`echo_requests_total{code="200",host="example.com:8080",method="POST",url="/users/:id"} 1`,
+				`echo_request_duration_seconds_bucket{code="200",host="example.com:8080",method="POST",url="/users/:id",le="0.005"}`,
+				`echo_request_size_bytes_bucket{code="200",host="example.com:8080",method="POST",url="/users/:id",le="1024"}`,
+				`echo_requests_in_progress_total{method="POST"} 0`,
+			},
+		},
+		{
+			name:      "gin",
+			naming:    NamingGin,
+			subsystem: "gin",
+			want: []string{
+				`# HELP gin_request_duration_seconds The HTTP request latencies in seconds.`,
+				`gin_requests_total{code="200",handler="/users/:id",host="example.com:8080",method="POST",url="/users/:id"} 1`,
+				`gin_request_duration_seconds_count{code="200",method="POST",url="/users/:id"} 1`,
+				`gin_request_size_bytes_count{code="200",method="POST",url="/users/:id"} 1`,
+			},
+		},
+		{
+			name:   "promhttp",
+			naming: NamingPromhttp,
+			want: []string{
+				`http_requests_total{code="200",handler="/users/:id",method="post"} 1`,
+				`http_request_duration_seconds_bucket{code="200",handler="/users/:id",method="post",le="10"} 1`,
+				`http_request_size_bytes_count{code="200",handler="/users/:id",method="post"} 1`,
+				`http_requests_in_flight{method="post"} 0`,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ps, err := NewWithConfig(Config{
+				Subsystem:         tc.subsystem,
+				Naming:            tc.naming,
+				EnableRequestSize: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			app := fiber.New()
+			ps.RegisterAt(app, "/metrics")
+			app.Use(ps.Middleware)
+			app.Post("/users/:id", func(c *fiber.Ctx) error { return c.SendString("user") })
+
+			req := httptest.NewRequest("POST", "/users/1", strings.NewReader("12345"))
+			req.Host = "example.com:8080"
+			app.Test(req, -1)
+
+			resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			got := string(body)
+
+			for _, want := range tc.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("got %s; want %s", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNamingGinHandler(t *testing.T) {
+	t.Parallel()
+
+	ps, err := NewWithConfig(Config{Subsystem: "gin", Naming: NamingGin})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	ps.RegisterAt(app, "/metrics")
+	app.Use(ps.Middleware)
+	app.Get("/users/:id", func(c *fiber.Ctx) error { return c.SendString("user") }).Name("getUser")
+
+	app.Test(httptest.NewRequest("GET", "/users/1", nil), -1)
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+
+	want := `gin_requests_total{code="200",handler="getUser",host="example.com",method="GET",url="/users/:id"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
@@ -0,0 +1,107 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+)
+
+// meterName is the instrumentation scope of the OpenTelemetry instruments.
+const meterName = "github.com/ansrivas/fiberprometheus/v2"
+
+// otelDurationBuckets are the bucket boundaries advised by the HTTP semantic
+// conventions for http.server.request.duration.
+var otelDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10}
+
+// otelRecorder records the request metrics through an OpenTelemetry meter,
+// following the HTTP semantic conventions.
+type otelRecorder struct {
+	duration       metric.Float64Histogram
+	activeRequests metric.Int64UpDownCounter
+}
+
+func newOtelRecorder(provider metric.MeterProvider) (*otelRecorder, error) {
+	meter := provider.Meter(meterName, metric.WithSchemaURL(semconv.SchemaURL))
+
+	duration, err := meter.Float64Histogram(
+		"http.server.request.duration",
+		metric.WithDescription("Duration of HTTP server requests."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(otelDurationBuckets...),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	activeRequests, err := meter.Int64UpDownCounter(
+		"http.server.active_requests",
+		metric.WithDescription("Number of active HTTP server requests."),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &otelRecorder{duration: duration, activeRequests: activeRequests}, nil
+}
+
+// startRequest counts the request as active and returns the function to call
+// once it is done.
+func (o *otelRecorder) startRequest(ctx context.Context, method, scheme string) func() {
+	attrs := metric.WithAttributeSet(attribute.NewSet(
+		semconv.HTTPRequestMethodKey.String(method),
+		semconv.URLSchemeKey.String(scheme),
+	))
+	o.activeRequests.Add(ctx, 1, attrs)
+	return func() {
+		o.activeRequests.Add(ctx, -1, attrs)
+	}
+}
+
+// recordOtelDuration records the duration of a request. route is empty for
+// requests that matched no route. Custom labels of request_duration_seconds
+// are recorded as attributes.
+func (ps *FiberPrometheus) recordOtelDuration(ctx *fiber.Ctx, status int, method, scheme, route string, values labelValues, elapsed float64) {
+	attrs := make([]attribute.KeyValue, 0, 5+len(ps.extraLabels[MetricRequestDuration]))
+	attrs = append(attrs,
+		semconv.HTTPRequestMethodKey.String(method),
+		semconv.URLSchemeKey.String(scheme),
+		semconv.HTTPResponseStatusCodeKey.Int(status),
+	)
+	if route != "" {
+		attrs = append(attrs, semconv.HTTPRouteKey.String(route))
+	}
+	if status >= fiber.StatusInternalServerError {
+		attrs = append(attrs, semconv.ErrorTypeKey.String(strconv.Itoa(status)))
+	}
+	for _, i := range ps.extraLabels[MetricRequestDuration] {
+		attrs = append(attrs, attribute.String(ps.labels[i].Name, values.extra[i]))
+	}
+
+	ps.otel.duration.Record(ctx.UserContext(), elapsed, metric.WithAttributes(attrs...))
+}
@@ -0,0 +1,157 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// collectOtel returns the metrics recorded by the reader, by name.
+func collectOtel(t *testing.T, reader sdkmetric.Reader) map[string]metricdata.Metrics {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	metrics := make(map[string]metricdata.Metrics)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+	return metrics
+}
+
+func TestOtelBackend(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name              string
+		disablePrometheus bool
+	}{
+		{name: "with prometheus"},
+		{name: "otel only", disablePrometheus: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := sdkmetric.NewManualReader()
+			registry := prometheus.NewRegistry()
+			ps, err := NewWithConfig(Config{
+				Registerer:        registry,
+				MeterProvider:     sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+				DisablePrometheus: tt.disablePrometheus,
+				Labels: []Label{{
+					Name:    "tenant",
+					Extract: func(c *fiber.Ctx) string { return c.Get("X-Tenant") },
+					Metrics: []Metric{MetricRequestDuration},
+				}},
+			})
+			if err != nil {
+				t.Fatalf("NewWithConfig: %v", err)
+			}
+
+			app := fiber.New()
+			app.Use(ps.Middleware)
+			app.Get("/users/:id", func(c *fiber.Ctx) error { return c.SendString("user") })
+			app.Get("/fail", func(c *fiber.Ctx) error { return fiber.ErrBadGateway })
+
+			req := httptest.NewRequest("GET", "/users/1", nil)
+			req.Header.Set("X-Tenant", "acme")
+			app.Test(req, -1)
+			app.Test(httptest.NewRequest("GET", "/fail", nil), -1)
+
+			metrics := collectOtel(t, reader)
+
+			duration, ok := metrics["http.server.request.duration"].Data.(metricdata.Histogram[float64])
+			if !ok {
+				t.Fatalf("http.server.request.duration not recorded: %+v", metrics)
+			}
+			if got := metrics["http.server.request.duration"].Unit; got != "s" {
+				t.Errorf("got unit %q; want s", got)
+			}
+
+			want := map[attribute.Set]bool{
+				attribute.NewSet(
+					attribute.String("http.request.method", "GET"),
+					attribute.String("url.scheme", "http"),
+					attribute.Int("http.response.status_code", 200),
+					attribute.String("http.route", "/users/:id"),
+					attribute.String("tenant", "acme"),
+				): true,
+				attribute.NewSet(
+					attribute.String("http.request.method", "GET"),
+					attribute.String("url.scheme", "http"),
+					attribute.Int("http.response.status_code", 502),
+					attribute.String("http.route", "/fail"),
+					attribute.String("error.type", "502"),
+					attribute.String("tenant", ""),
+				): true,
+			}
+			if len(duration.DataPoints) != len(want) {
+				t.Errorf("got %d data points; want %d", len(duration.DataPoints), len(want))
+			}
+			for _, dp := range duration.DataPoints {
+				if !want[dp.Attributes] {
+					t.Errorf("unexpected attributes %v", dp.Attributes.ToSlice())
+				}
+				if dp.Count != 1 {
+					t.Errorf("got count %d for %v; want 1", dp.Count, dp.Attributes.ToSlice())
+				}
+			}
+
+			active, ok := metrics["http.server.active_requests"].Data.(metricdata.Sum[int64])
+			if !ok || len(active.DataPoints) != 1 {
+				t.Fatalf("http.server.active_requests not recorded: %+v", metrics)
+			}
+			if got := active.DataPoints[0].Value; got != 0 {
+				t.Errorf("got %d active requests after all requests; want 0", got)
+			}
+
+			wantPrometheus := 2
+			if tt.disablePrometheus {
+				wantPrometheus = 0
+			}
+			if got, _ := testutil.GatherAndCount(registry, "requests_total"); got != wantPrometheus {
+				t.Errorf("got %d prometheus series; want %d", got, wantPrometheus)
+			}
+		})
+	}
+}
+
+func TestDisablePrometheusRequiresMeterProvider(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewWithConfig(Config{DisablePrometheus: true}); err == nil {
+		t.Error("expected an error")
+	}
+}
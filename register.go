@@ -0,0 +1,75 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// registrar registers the collectors of a FiberPrometheus instance. The
+// first error is kept and later registrations are skipped.
+type registrar struct {
+	registerer prometheus.Registerer
+	reuse      bool
+	registered []prometheus.Collector
+	reused     map[prometheus.Collector]bool
+	err        error
+}
+
+// register registers *c. If reuse is set and an identical collector is
+// already registered, *c is replaced with the existing collector instead.
+func register[T prometheus.Collector](r *registrar, c *T) {
+	if r.err != nil {
+		return
+	}
+
+	err := r.registerer.Register(*c)
+	if err == nil {
+		r.registered = append(r.registered, *c)
+		return
+	}
+
+	are := prometheus.AlreadyRegisteredError{}
+	if r.reuse && errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(T); ok {
+			*c = existing
+			if r.reused == nil {
+				r.reused = make(map[prometheus.Collector]bool)
+			}
+			r.reused[existing] = true
+			return
+		}
+	}
+	r.err = fmt.Errorf("fiberprometheus: %w", err)
+}
+
+// unregister unregisters the collectors registered so far, leaving the
+// reused ones in place.
+func (r *registrar) unregister() {
+	for _, c := range r.registered {
+		r.registerer.Unregister(c)
+	}
+	r.registered = nil
+}
@@ -0,0 +1,106 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDuplicateRegistration(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	if _, err := NewWithConfig(Config{Registerer: registry}); err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+
+	_, err := NewWithConfig(Config{Registerer: registry})
+	are := prometheus.AlreadyRegisteredError{}
+	if !errors.As(err, &are) {
+		t.Fatalf("expected a prometheus.AlreadyRegisteredError, got %v", err)
+	}
+}
+
+func TestRegistrationRollback(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	// Conflicts with the requests in progress gauge, registered after the
+	// requests counter and duration histogram.
+	registry.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "requests_in_progress_total", Help: "Conflicting."}))
+
+	if _, err := NewWithConfig(Config{Registerer: registry}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	if len(families) != 1 {
+		t.Errorf("expected the collectors to be unregistered, got %d families", len(families))
+	}
+}
+
+func TestReuseExistingCollectors(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	cfg := Config{Registerer: registry, ReuseExistingCollectors: true}
+
+	first, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+	second, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig with existing collectors: %v", err)
+	}
+	if first.requestsTotal != second.requestsTotal {
+		t.Error("expected the requests counter to be reused")
+	}
+
+	for _, ps := range []*FiberPrometheus{first, second} {
+		app := fiber.New()
+		app.Use(ps.Middleware)
+		app.Get("/", func(c *fiber.Ctx) error { return c.SendString("Hello World") })
+		app.Test(httptest.NewRequest("GET", "/", nil), -1)
+	}
+
+	app := fiber.New()
+	first.RegisterAt(app, "/metrics")
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	want := `requests_total{method="GET",path="/",status_code="200"} 2`
+	if !strings.Contains(string(body), want) {
+		t.Errorf("got %s; want %s", body, want)
+	}
+}
@@ -0,0 +1,187 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// appState is what the middleware tracks for each fiber.App it serves, so
+// that one FiberPrometheus can be shared by several apps.
+type appState struct {
+	name     string
+	routes   atomic.Pointer[routeTable]
+	routesMu sync.Mutex
+	onBuild  func(*routeTable) // called with each new route table, may be nil
+}
+
+// routeTable is an immutable snapshot of the routes registered on an app,
+// keyed by method and normalized path. Routes of mounted sub-apps carry
+// their mount prefix. The metrics endpoints are kept apart in scrapes, keyed
+// by scrapePath.
+type routeTable struct {
+	handlersCount uint32
+	routes        map[string]struct{}
+	scrapes       map[string]struct{}
+}
+
+// isScrape reports whether the request is served by a metrics endpoint.
+func (t *routeTable) isScrape(app *fiber.App, method, requestPath string) bool {
+	if len(t.scrapes) == 0 || (method != fiber.MethodGet && method != fiber.MethodHead) {
+		return false
+	}
+	_, ok := t.scrapes[scrapePath(app, requestPath)]
+	return ok
+}
+
+// scrapePath normalizes a path the way the router matches it.
+func scrapePath(app *fiber.App, p string) string {
+	if !app.Config().CaseSensitive {
+		p = strings.ToLower(p)
+	}
+	return normalizePath(p)
+}
+
+// scrapeHandlerPC identifies the routes registered by RegisterAt, which all
+// start with the instrumentScrape method value of some FiberPrometheus.
+var scrapeHandlerPC uintptr
+
+func init() {
+	scrapeHandlerPC = reflect.ValueOf(fiber.Handler((&FiberPrometheus{}).instrumentScrape)).Pointer()
+}
+
+// app returns the state of the given app, creating it on first use.
+func (ps *FiberPrometheus) app(app *fiber.App) *appState {
+	if state, ok := ps.apps.Load(app); ok {
+		return state.(*appState)
+	}
+	state := &appState{name: app.Config().AppName}
+	if len(ps.initStatusCodes) > 0 {
+		state.onBuild = func(table *routeTable) {
+			ps.initSeries(state, table)
+		}
+	}
+	actual, _ := ps.apps.LoadOrStore(app, state)
+	return actual.(*appState)
+}
+
+// InitRoutes creates the zero-valued series of Config.InitStatusCodes for the
+// routes registered on app so far. The middleware does so itself once it
+// sees the app, so this is only needed to export the series before the first
+// request or scrape, e.g. from an OnListen hook.
+func (ps *FiberPrometheus) InitRoutes(app *fiber.App) {
+	ps.app(app).registeredRoutes(app)
+}
+
+// initSeries creates the requests_total and request duration series of the
+// routes in table for each of Config.InitStatusCodes.
+func (ps *FiberPrometheus) initSeries(state *appState, table *routeTable) {
+	// Label values extracted from requests cannot be known in advance
+	initializable := func(m Metric) bool {
+		return len(ps.extraLabels[m]) == 0 && len(ps.attributeIndexes[m]) == 0
+	}
+	initTotal := ps.requestsTotal != nil && initializable(MetricRequestsTotal)
+	initDuration := ps.requestDuration != nil && initializable(MetricRequestDuration)
+	initSummary := ps.durationSummary != nil && initializable(MetricRequestDurationSummary)
+	if !initTotal && !initDuration && !initSummary {
+		return
+	}
+
+	for route := range table.routes {
+		method, routePath, _ := strings.Cut(route, " ")
+		if method == fiber.MethodHead || ps.skipPaths[routePath] {
+			continue
+		}
+		if ps.skipRules != nil && ps.skipRules.matchRoute(method, routePath) {
+			continue
+		}
+		if ps.lowercaseMethod {
+			method = strings.ToLower(method)
+		}
+
+		for _, code := range ps.initStatusCodes {
+			if ps.ignoreStatusCodes[code] {
+				continue
+			}
+			values := []string{strconv.Itoa(code), method, routePath}
+			if ps.appLabel {
+				values = append(values, state.name)
+			}
+			if initTotal {
+				ps.requestsTotal.WithLabelValues(values...)
+			}
+			if initDuration {
+				ps.requestDuration.WithLabelValues(values...)
+			}
+			if initSummary {
+				ps.durationSummary.WithLabelValues(values...)
+			}
+		}
+	}
+}
+
+// registeredRoutes returns the route table of the app, rebuilding it whenever
+// the app's handler count changes so that routes added after the first
+// request, or mounted when the app starts, are picked up.
+func (s *appState) registeredRoutes(app *fiber.App) *routeTable {
+	count := app.HandlersCount()
+	if table := s.routes.Load(); table != nil && table.handlersCount == count {
+		return table
+	}
+
+	s.routesMu.Lock()
+	defer s.routesMu.Unlock()
+
+	if table := s.routes.Load(); table != nil && table.handlersCount == count {
+		return table
+	}
+
+	table := &routeTable{
+		handlersCount: count,
+		routes:        make(map[string]struct{}),
+		scrapes:       make(map[string]struct{}),
+	}
+	for _, r := range app.GetRoutes(true) {
+		// Scrapes are never recorded, keep the metrics endpoints apart
+		if len(r.Handlers) > 0 && reflect.ValueOf(r.Handlers[0]).Pointer() == scrapeHandlerPC {
+			table.scrapes[scrapePath(app, r.Path)] = struct{}{}
+			continue
+		}
+		p := r.Path
+		if p != "" && p != "/" {
+			p = normalizePath(p)
+		}
+		table.routes[r.Method+" "+p] = struct{}{}
+	}
+	s.routes.Store(table)
+	if s.onBuild != nil {
+		s.onBuild(table)
+	}
+
+	return table
+}
@@ -0,0 +1,215 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSharedAcrossApps(t *testing.T) {
+	t.Parallel()
+
+	prometheus, err := NewWithConfig(Config{ServiceName: "shared", Namespace: "http", AppLabel: true})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+
+	public := fiber.New(fiber.Config{AppName: "public"})
+	public.Use(prometheus.Middleware)
+	public.Get("/", func(c *fiber.Ctx) error { return c.SendString("public") })
+
+	admin := fiber.New(fiber.Config{AppName: "admin"})
+	admin.Use(prometheus.Middleware)
+	admin.Get("/users", func(c *fiber.Ctx) error { return c.SendString("admin") })
+	prometheus.RegisterAt(admin, "/metrics")
+
+	public.Test(httptest.NewRequest("GET", "/", nil), -1)
+	admin.Test(httptest.NewRequest("GET", "/users", nil), -1)
+	admin.Test(httptest.NewRequest("GET", "/", nil), -1)
+
+	resp, _ := admin.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+
+	want := `http_requests_total{app="public",method="GET",path="/",service="shared",status_code="200"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	want = `http_requests_total{app="admin",method="GET",path="/users",service="shared",status_code="200"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	// "/" is only registered on the public app
+	if strings.Contains(got, `app="admin",method="GET",path="/",`) {
+		t.Errorf("metrics should skip routes unregistered on the admin app: %s", got)
+	}
+
+	want = `http_requests_in_progress_total{app="public",method="GET",service="shared"} 0`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
+
+func TestMountedSubApp(t *testing.T) {
+	t.Parallel()
+
+	prometheus := New("mounted")
+
+	app := fiber.New()
+	prometheus.RegisterAt(app, "/metrics")
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("root") })
+
+	sub := fiber.New()
+	sub.Use(prometheus.Middleware)
+	sub.Get("/users/:id", func(c *fiber.Ctx) error { return c.SendString("user") })
+	app.Mount("/admin", sub)
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/admin/users/42", nil), -1)
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	resp, _ = app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+
+	want := `http_requests_total{method="GET",path="/admin/users/:id",service="mounted",status_code="200"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
+
+func TestAppLabelValidation(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewWithConfig(Config{AppLabel: true, ConstLabels: map[string]string{"app": "x"}}); err == nil {
+		t.Error("expected an error for a const label colliding with AppLabel")
+	}
+}
+
+func TestInitStatusCodes(t *testing.T) {
+	t.Parallel()
+
+	prometheus, err := NewWithConfig(Config{
+		InitStatusCodes:   []int{200, 404, 500},
+		IgnoreStatusCodes: []int{404},
+		SkipPaths:         []string{"/healthz"},
+	})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+
+	app := fiber.New()
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(prometheus.Middleware)
+	app.Get("/users/:id", func(c *fiber.Ctx) error { return c.SendString("user") })
+	app.Post("/users", func(c *fiber.Ctx) error { return c.SendString("created") })
+	app.Get("/healthz", func(c *fiber.Ctx) error { return c.SendString("OK") })
+
+	scrape := func() string {
+		resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	// The first scrape exports the series before any request.
+	got := scrape()
+	for _, want := range []string{
+		`requests_total{method="GET",path="/users/:id",status_code="200"} 0`,
+		`requests_total{method="GET",path="/users/:id",status_code="500"} 0`,
+		`requests_total{method="POST",path="/users",status_code="200"} 0`,
+		`request_duration_seconds_count{method="POST",path="/users",status_code="500"} 0`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %s; want %s", got, want)
+		}
+	}
+	for _, notWant := range []string{`status_code="404"`, `path="/healthz"`, `method="HEAD"`, `path="/metrics"`} {
+		if strings.Contains(got, notWant) {
+			t.Errorf("got %s; want no %s series", got, notWant)
+		}
+	}
+
+	// Routes added later are initialized once the middleware sees them.
+	app.Delete("/users/:id", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) })
+	app.Test(httptest.NewRequest("GET", "/users/1", nil), -1)
+
+	got = scrape()
+	for _, want := range []string{
+		`requests_total{method="GET",path="/users/:id",status_code="200"} 1`,
+		`requests_total{method="DELETE",path="/users/:id",status_code="500"} 0`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %s; want %s", got, want)
+		}
+	}
+}
+
+func TestInitRoutesSkipsCustomLabels(t *testing.T) {
+	t.Parallel()
+
+	registry := prom.NewRegistry()
+	ps, err := NewWithConfig(Config{
+		Registerer:      registry,
+		InitStatusCodes: []int{200},
+		Labels: []Label{{
+			Name:    "tenant",
+			Extract: func(c *fiber.Ctx) string { return c.Get("X-Tenant") },
+			Metrics: []Metric{MetricRequestsTotal},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("Hello World") })
+	ps.InitRoutes(app)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, mf := range families {
+		switch mf.GetName() {
+		case "requests_total":
+			t.Errorf("requests_total has a custom label and should not be initialized")
+		case "request_duration_seconds":
+			if got := len(mf.GetMetric()); got != 1 {
+				t.Errorf("got %d request_duration_seconds series; want 1", got)
+			}
+			return
+		}
+	}
+	t.Error("request_duration_seconds was not initialized")
+}
@@ -0,0 +1,250 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// overflowValue replaces all variable label values of the observations
+// folded into the overflow series once a cardinality limit is reached.
+const overflowValue = "__overflow__"
+
+// seriesDeleter is implemented by the metric vectors.
+type seriesDeleter interface {
+	prometheus.Collector
+	DeleteLabelValues(lvs ...string) bool
+}
+
+// sharedTrackers holds the trackers of all instances by vector, so that
+// instances sharing collectors through ReuseExistingCollectors also share
+// the tracking of their series.
+var sharedTrackers = struct {
+	sync.Mutex
+	trackers map[seriesDeleter]*seriesTracker
+}{trackers: make(map[seriesDeleter]*seriesTracker)}
+
+// seriesTracker tracks the series of a metric vector and when each was last
+// updated, so that idle series can be deleted and the number of series can
+// be limited.
+type seriesTracker struct {
+	vec   seriesDeleter
+	limit int // 0 means unlimited
+	refs  int // instances using the tracker, guarded by sharedTrackers
+
+	mu     sync.RWMutex
+	series map[string]*trackedSeries
+	count  int // series counting against the limit
+}
+
+// trackedSeries is a series of the vector, identified by its label values.
+type trackedSeries struct {
+	values   []string
+	overflow bool
+	lastSeen atomic.Int64 // unix nanoseconds
+}
+
+func newSeriesTracker(vec seriesDeleter, limit int) *seriesTracker {
+	return &seriesTracker{
+		vec:    vec,
+		limit:  limit,
+		series: make(map[string]*trackedSeries),
+	}
+}
+
+// touch records that the series with the given label values is updated
+// now. It must be called before the series is updated, so that the update
+// can't race with the series being deleted by expire. A new series is
+// rejected if the tracker already holds limit series, unless it is the
+// overflow series, which doesn't count against the limit.
+func (t *seriesTracker) touch(values []string, overflow bool) bool {
+	now := time.Now().UnixNano()
+	key := strings.Join(values, "\xff")
+
+	t.mu.RLock()
+	s, ok := t.series[key]
+	if ok {
+		s.lastSeen.Store(now)
+	}
+	t.mu.RUnlock()
+	if ok {
+		return true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s, ok = t.series[key]; !ok {
+		if !overflow {
+			if t.limit > 0 && t.count >= t.limit {
+				return false
+			}
+			t.count++
+		}
+		s = &trackedSeries{values: append([]string(nil), values...), overflow: overflow}
+		t.series[key] = s
+	}
+	s.lastSeen.Store(now)
+	return true
+}
+
+// expire deletes the series last updated before the given time and returns
+// how many were deleted.
+func (t *seriesTracker) expire(before int64) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	evicted := 0
+	for key, s := range t.series {
+		if s.lastSeen.Load() >= before {
+			continue
+		}
+		t.vec.DeleteLabelValues(s.values...)
+		delete(t.series, key)
+		if !s.overflow {
+			t.count--
+		}
+		evicted++
+	}
+	return evicted
+}
+
+// seriesValues returns the label values of request metric m for the request.
+func (ps *FiberPrometheus) seriesValues(m Metric, values labelValues) []string {
+	return ps.trackedValues(m, values.of(m))
+}
+
+// trackedValues records the series of metric m with the given label values
+// as updated, if series of m are tracked. If the series would exceed the
+// cardinality limit of m, the observation is counted and the label values
+// of the overflow series are returned instead.
+func (ps *FiberPrometheus) trackedValues(m Metric, lvs []string) []string {
+	t := ps.trackers[m]
+	if t == nil || t.touch(lvs, false) {
+		return lvs
+	}
+
+	ps.cardinalityExceeded.WithLabelValues(m.String()).Inc()
+	overflow := ps.overflowValues[m]
+	t.touch(overflow, true)
+	return overflow
+}
+
+// initTrackers sets up the series trackers needed to expire idle series or
+// to limit the number of series. labelNames returns the variable label names
+// of a metric. The trackers of reused vectors are shared with the instances
+// which registered them, which must limit their series alike.
+func (ps *FiberPrometheus) initTrackers(cfg Config, labelNames func(Metric) []string, reused map[prometheus.Collector]bool) error {
+	vecs := make(map[Metric]seriesDeleter)
+	if ps.requestsTotal != nil {
+		vecs[MetricRequestsTotal] = ps.requestsTotal
+	}
+	if ps.requestDuration != nil {
+		vecs[MetricRequestDuration] = ps.requestDuration
+	}
+	if ps.requestInFlight != nil {
+		vecs[MetricRequestsInFlight] = ps.requestInFlight
+	}
+	if ps.requestSize != nil {
+		vecs[MetricRequestSize] = ps.requestSize
+	}
+	if ps.responseSize != nil {
+		vecs[MetricResponseSize] = ps.responseSize
+	}
+	if ps.durationSummary != nil {
+		vecs[MetricRequestDurationSummary] = ps.durationSummary
+	}
+
+	limits := make(map[Metric]int, len(vecs))
+	tracked := make(map[Metric]bool, len(vecs))
+	for m := range vecs {
+		limits[m] = cfg.CardinalityLimit
+		if l, ok := cfg.CardinalityLimits[m]; ok {
+			limits[m] = l
+		}
+		// In-flight series are never deleted, so they are only tracked to
+		// enforce a limit
+		expires := cfg.SeriesTTL > 0 && m != MetricRequestsInFlight
+		tracked[m] = limits[m] > 0 || expires
+	}
+
+	sharedTrackers.Lock()
+	defer sharedTrackers.Unlock()
+
+	// Check all metrics before taking any tracker
+	for m, vec := range vecs {
+		shared := sharedTrackers.trackers[vec]
+		if shared != nil && shared.limit != limits[m] {
+			return fmt.Errorf("fiberprometheus: reused %v has a cardinality limit of %d, not %d", m, shared.limit, limits[m])
+		}
+		if shared == nil && tracked[m] && reused[vec] {
+			return fmt.Errorf("fiberprometheus: cannot limit or expire the series of reused %v, its other users don't track them", m)
+		}
+	}
+
+	for m, vec := range vecs {
+		t := sharedTrackers.trackers[vec]
+		if t == nil {
+			if !tracked[m] {
+				continue
+			}
+			t = newSeriesTracker(vec, limits[m])
+			sharedTrackers.trackers[vec] = t
+		}
+		t.refs++
+
+		if ps.trackers == nil {
+			ps.trackers = make(map[Metric]*seriesTracker)
+		}
+		ps.trackers[m] = t
+
+		if limits[m] > 0 {
+			if ps.overflowValues == nil {
+				ps.overflowValues = make(map[Metric][]string)
+			}
+			ps.overflowValues[m] = make([]string, len(labelNames(m)))
+			for i := range ps.overflowValues[m] {
+				ps.overflowValues[m][i] = overflowValue
+			}
+		}
+	}
+	return nil
+}
+
+// releaseTrackers gives up the trackers of the instance, forgetting those no
+// other instance uses.
+func (ps *FiberPrometheus) releaseTrackers() {
+	sharedTrackers.Lock()
+	defer sharedTrackers.Unlock()
+
+	for _, t := range ps.trackers {
+		t.refs--
+		if t.refs == 0 {
+			delete(sharedTrackers.trackers, t.vec)
+		}
+	}
+}
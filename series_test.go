@@ -0,0 +1,238 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCardinalityLimit(t *testing.T) {
+	t.Parallel()
+
+	ps, err := NewWithConfig(Config{
+		CardinalityLimit:  2,
+		CardinalityLimits: map[Metric]int{MetricRequestDuration: 0},
+		Labels: []Label{{
+			Name:    "tenant",
+			Extract: func(c *fiber.Ctx) string { return c.Get("X-Tenant") },
+			Metrics: []Metric{MetricRequestsTotal},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+
+	app := fiber.New()
+	ps.RegisterAt(app, "/metrics")
+	app.Use(ps.Middleware)
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("Hello World") })
+
+	for _, tenant := range []string{"a", "b", "c", "d", "a"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Tenant", tenant)
+		app.Test(req, -1)
+	}
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+
+	for _, want := range []string{
+		`requests_total{method="GET",path="/",status_code="200",tenant="a"} 2`,
+		`requests_total{method="GET",path="/",status_code="200",tenant="b"} 1`,
+		`requests_total{method="__overflow__",path="__overflow__",status_code="__overflow__",tenant="__overflow__"} 2`,
+		`cardinality_limit_exceeded_total{metric="requests_total"} 2`,
+		`request_duration_seconds_count{method="GET",path="/",status_code="200"} 5`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %s; want %s", got, want)
+		}
+	}
+	if strings.Contains(got, `tenant="c"`) {
+		t.Errorf("series beyond the limit should not be created: %s", got)
+	}
+}
+
+func TestCardinalityLimitInFlight(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	ps, err := NewWithConfig(Config{
+		Registerer:        registry,
+		CardinalityLimits: map[Metric]int{MetricRequestsInFlight: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+
+	app := fiber.New()
+	app.Use(ps.Middleware)
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("Hello World") })
+
+	for _, method := range []string{"GET", "PUT", "DELETE"} {
+		app.Test(httptest.NewRequest(method, "/", nil), -1)
+	}
+
+	if got := testutil.CollectAndCount(ps.requestInFlight); got != 2 {
+		t.Errorf("got %d in-flight series; want GET and the overflow series", got)
+	}
+	if got := testutil.ToFloat64(ps.cardinalityExceeded.WithLabelValues("requests_in_progress_total")); got != 2 {
+		t.Errorf("got %v folded observations; want 2", got)
+	}
+	if got := testutil.ToFloat64(ps.requestInFlight.WithLabelValues(overflowValue)); got != 0 {
+		t.Errorf("overflow in-flight gauge is %v after all requests; want 0", got)
+	}
+}
+
+func TestCardinalityLimitWithExpiry(t *testing.T) {
+	t.Parallel()
+
+	ps, err := NewWithConfig(Config{CardinalityLimit: 1, SeriesTTL: time.Hour})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+	defer ps.Close()
+
+	app := fiber.New()
+	app.Use(ps.Middleware)
+	app.Get("/old", func(c *fiber.Ctx) error { return c.SendString("old") })
+	app.Get("/new", func(c *fiber.Ctx) error { return c.SendString("new") })
+
+	app.Test(httptest.NewRequest("GET", "/old", nil), -1)
+	ps.expireSeries(time.Now())
+	app.Test(httptest.NewRequest("GET", "/new", nil), -1)
+
+	if got := testutil.ToFloat64(ps.requestsTotal.WithLabelValues("200", "GET", "/new")); got != 1 {
+		t.Errorf("expired series should make room for new ones, got %v", got)
+	}
+}
+
+func TestCardinalityLimitValidation(t *testing.T) {
+	t.Parallel()
+
+	for _, cfg := range []Config{
+		{CardinalityLimit: -1},
+		{CardinalityLimits: map[Metric]int{MetricRequestsTotal: -1}},
+		{CardinalityLimits: map[Metric]int{Metric(42): 10}},
+	} {
+		if _, err := NewWithConfig(cfg); err == nil {
+			t.Errorf("expected an error for %+v", cfg)
+		}
+	}
+}
+
+func TestSharedCollectorsTracking(t *testing.T) {
+	t.Parallel()
+
+	newInstance := func(t *testing.T, registry *prometheus.Registry, path string, cfg Config) (*FiberPrometheus, *fiber.App) {
+		t.Helper()
+
+		cfg.Registerer = registry
+		cfg.ReuseExistingCollectors = true
+		ps, err := NewWithConfig(cfg)
+		if err != nil {
+			t.Fatalf("NewWithConfig: %v", err)
+		}
+		t.Cleanup(func() { ps.Close() })
+
+		app := fiber.New()
+		app.Use(ps.Middleware)
+		app.Get(path, func(c *fiber.Ctx) error { return c.SendString("Hello World") })
+		return ps, app
+	}
+
+	t.Run("limit", func(t *testing.T) {
+		registry := prometheus.NewRegistry()
+		a, appA := newInstance(t, registry, "/a", Config{CardinalityLimit: 1})
+		_, appB := newInstance(t, registry, "/b", Config{CardinalityLimit: 1})
+
+		appA.Test(httptest.NewRequest("GET", "/a", nil), -1)
+		appB.Test(httptest.NewRequest("GET", "/b", nil), -1)
+
+		if got := testutil.CollectAndCount(a.requestsTotal); got != 2 {
+			t.Errorf("got %d series; want /a and the overflow series", got)
+		}
+		if got := testutil.ToFloat64(a.requestsTotal.WithLabelValues(overflowValue, overflowValue, overflowValue)); got != 1 {
+			t.Errorf("got %v overflow requests; want 1", got)
+		}
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		registry := prometheus.NewRegistry()
+		a, appA := newInstance(t, registry, "/x", Config{SeriesTTL: time.Hour})
+		_, appB := newInstance(t, registry, "/x", Config{SeriesTTL: time.Hour})
+
+		appA.Test(httptest.NewRequest("GET", "/x", nil), -1)
+		before := time.Now()
+		appB.Test(httptest.NewRequest("GET", "/x", nil), -1)
+
+		// The series was updated by B after before, A must not delete it
+		a.expireSeries(before)
+		if got := testutil.ToFloat64(a.requestsTotal.WithLabelValues("200", "GET", "/x")); got != 2 {
+			t.Errorf("got %v requests; want 2", got)
+		}
+	})
+
+	t.Run("conflicts", func(t *testing.T) {
+		registry := prometheus.NewRegistry()
+		newInstance(t, registry, "/", Config{CardinalityLimit: 1})
+		if _, err := NewWithConfig(Config{Registerer: registry, ReuseExistingCollectors: true, CardinalityLimit: 2}); err == nil {
+			t.Error("expected an error for a different limit")
+		}
+
+		registry = prometheus.NewRegistry()
+		newInstance(t, registry, "/", Config{})
+		if _, err := NewWithConfig(Config{Registerer: registry, ReuseExistingCollectors: true, SeriesTTL: time.Hour}); err == nil {
+			t.Error("expected an error for expiring untracked series")
+		}
+	})
+
+	t.Run("release", func(t *testing.T) {
+		registry := prometheus.NewRegistry()
+		a, _ := newInstance(t, registry, "/", Config{SeriesTTL: time.Hour})
+		b, _ := newInstance(t, registry, "/", Config{SeriesTTL: time.Hour})
+		vec := a.trackers[MetricRequestsTotal].vec
+
+		isShared := func() bool {
+			sharedTrackers.Lock()
+			defer sharedTrackers.Unlock()
+			return sharedTrackers.trackers[vec] != nil
+		}
+		a.Close()
+		if !isShared() {
+			t.Error("the tracker should be kept while b uses it")
+		}
+		b.Close()
+		if isShared() {
+			t.Error("the tracker should be forgotten once unused")
+		}
+	})
+}
@@ -0,0 +1,137 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// metricsServer is the dedicated Fiber app serving the metrics.
+type metricsServer struct {
+	app      *fiber.App
+	listener net.Listener
+	done     chan struct{}
+}
+
+// ListenAndServe serves the metrics on a dedicated Fiber app listening on
+// addr, like RegisterAt does on the application. It blocks until the server
+// is shut down with ShutdownMetricsServer.
+func (ps *FiberPrometheus) ListenAndServe(addr string, handlers ...fiber.Handler) error {
+	server, err := ps.startMetricsServer(addr, handlers)
+	if err != nil {
+		return err
+	}
+	return server.serve()
+}
+
+// StartMetricsServer starts serving the metrics on a dedicated Fiber app
+// listening on addr, like RegisterAt does on the application. It returns once
+// the listener is bound, and shuts the server down gracefully when ctx is
+// done. To stop it with the application, register ShutdownMetricsServer as
+// an OnShutdown hook:
+//
+//	app.Hooks().OnShutdown(prometheus.ShutdownMetricsServer)
+func (ps *FiberPrometheus) StartMetricsServer(ctx context.Context, addr string, handlers ...fiber.Handler) error {
+	server, err := ps.startMetricsServer(addr, handlers)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := server.serve(); err != nil {
+			log.Errorf("fiberprometheus: metrics server: %v", err)
+		}
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			if err := ps.shutdownMetricsServer(server); err != nil {
+				log.Errorf("fiberprometheus: metrics server shutdown: %v", err)
+			}
+		case <-server.done:
+		}
+	}()
+	return nil
+}
+
+// ShutdownMetricsServer gracefully shuts down the server started by
+// ListenAndServe or StartMetricsServer, waiting for active scrapes to
+// complete. It does nothing if no server is running.
+func (ps *FiberPrometheus) ShutdownMetricsServer() error {
+	ps.serverMu.Lock()
+	server := ps.server
+	ps.serverMu.Unlock()
+
+	if server == nil {
+		return nil
+	}
+	return ps.shutdownMetricsServer(server)
+}
+
+// startMetricsServer binds the listener and sets up the app serving the
+// metrics, failing if a server is already running.
+func (ps *FiberPrometheus) startMetricsServer(addr string, handlers []fiber.Handler) (*metricsServer, error) {
+	ps.serverMu.Lock()
+	defer ps.serverMu.Unlock()
+
+	if ps.server != nil {
+		return nil, errors.New("fiberprometheus: metrics server is already running")
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	ps.RegisterAt(app, ps.defaultURL, handlers...)
+
+	ps.server = &metricsServer{app: app, listener: listener, done: make(chan struct{})}
+	return ps.server, nil
+}
+
+// serve serves the metrics until the server is shut down.
+func (s *metricsServer) serve() error {
+	defer close(s.done)
+	return s.app.Listener(s.listener)
+}
+
+// shutdownMetricsServer shuts down server and waits for it to stop serving.
+func (ps *FiberPrometheus) shutdownMetricsServer(server *metricsServer) error {
+	ps.serverMu.Lock()
+	if ps.server == server {
+		ps.server = nil
+	}
+	ps.serverMu.Unlock()
+
+	err := server.app.Shutdown()
+	// Serve may not have been called yet, closing the listener makes it
+	// return immediately.
+	_ = server.listener.Close()
+	<-server.done
+	return err
+}
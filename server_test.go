@@ -0,0 +1,150 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// freeAddr returns a local address with a free port.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func scrapeBody(t *testing.T, url string) string {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestStartMetricsServer(t *testing.T) {
+	t.Parallel()
+
+	ps, err := NewWithConfig(Config{Registerer: prometheus.NewRegistry(), Namespace: "server"})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+
+	app := fiber.New()
+	app.Use(ps.Middleware)
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("Hello World") })
+	app.Test(httptest.NewRequest("GET", "/", nil), -1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr := freeAddr(t)
+	if err := ps.StartMetricsServer(ctx, addr); err != nil {
+		t.Fatalf("StartMetricsServer: %v", err)
+	}
+	if err := ps.StartMetricsServer(ctx, freeAddr(t)); err == nil {
+		t.Error("expected an error when starting a second server")
+	}
+
+	want := `server_requests_total{method="GET",path="/",status_code="200"} 1`
+	if got := scrapeBody(t, "http://"+addr+"/metrics"); !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	// The metrics are not served by the application.
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+	if resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("got status %d from the application; want 404", resp.StatusCode)
+	}
+
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := http.Get("http://" + addr + "/metrics"); err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("metrics server still serving after the context was canceled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestListenAndServe(t *testing.T) {
+	t.Parallel()
+
+	ps, err := NewWithConfig(Config{Registerer: prometheus.NewRegistry()})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+
+	app := fiber.New()
+	app.Hooks().OnShutdown(ps.ShutdownMetricsServer)
+
+	addr := freeAddr(t)
+	served := make(chan error, 1)
+	go func() { served <- ps.ListenAndServe(addr) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if resp, err := http.Get("http://" + addr + "/metrics"); err == nil {
+			resp.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("metrics server not serving")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Shutting down the application shuts down the metrics server.
+	app.Shutdown()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("ListenAndServe: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ListenAndServe did not return after shutdown")
+	}
+
+	if err := ps.ShutdownMetricsServer(); err != nil {
+		t.Errorf("ShutdownMetricsServer without a server: %v", err)
+	}
+}
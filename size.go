@@ -0,0 +1,66 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// requestSize approximates the size of the request as received, that is
+// the request line, the headers and the body.
+func requestSize(ctx *fiber.Ctx) int {
+	return len(ctx.Request().Header.Header()) + requestBodySize(ctx)
+}
+
+// requestBodySize returns the size of the request body.
+func requestBodySize(ctx *fiber.Ctx) int {
+	req := ctx.Request()
+
+	// Don't drain a streamed body just to measure it
+	if req.IsBodyStream() {
+		if cl := req.Header.ContentLength(); cl > 0 {
+			return cl
+		}
+		return 0
+	}
+
+	return len(req.Body())
+}
+
+// responseSize returns the size of the response body, if it is known.
+//
+// Bodies set with SetBodyStream or SetBodyStreamWriter are only written once
+// the handler chain has returned and reading them here would drain the
+// stream, so their announced Content-Length is used instead. Streams of
+// unknown length (chunked responses) are reported as unknown, as fasthttp
+// offers no way to wrap a stream without closing it.
+func responseSize(ctx *fiber.Ctx) (int, bool) {
+	resp := ctx.Response()
+	if !resp.IsBodyStream() {
+		return len(resp.Body()), true
+	}
+
+	if cl := resp.Header.ContentLength(); cl >= 0 {
+		return cl, true
+	}
+	return 0, false
+}
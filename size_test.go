@@ -0,0 +1,130 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"bufio"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRequestAndResponseSize(t *testing.T) {
+	t.Parallel()
+
+	app := fiber.New()
+	prometheus, err := NewWithConfig(Config{
+		ServiceName:         "size-service",
+		Namespace:           "http",
+		EnableRequestSize:   true,
+		EnableResponseSize:  true,
+		ResponseSizeBuckets: []float64{10, 100},
+	})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(prometheus.Middleware)
+
+	app.Post("/echo", func(c *fiber.Ctx) error {
+		return c.Send(c.Body())
+	})
+	app.Get("/stream", func(c *fiber.Ctx) error {
+		return c.SendStream(strings.NewReader("streamed"), len("streamed"))
+	})
+	app.Get("/chunked", func(c *fiber.Ctx) error {
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			w.WriteString("chunked")
+		})
+		return nil
+	})
+
+	resp, _ := app.Test(httptest.NewRequest("POST", "/echo", strings.NewReader("hello world")), -1)
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	app.Test(httptest.NewRequest("GET", "/stream", nil), -1)
+
+	resp, _ = app.Test(httptest.NewRequest("GET", "/chunked", nil), -1)
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "chunked" {
+		t.Errorf("streamed body must be left untouched, got %q", body)
+	}
+
+	resp, _ = app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+	defer resp.Body.Close()
+	body, _ = io.ReadAll(resp.Body)
+	got := string(body)
+
+	want := `http_response_size_bytes_sum{method="POST",path="/echo",service="size-service",status_code="200"} 11`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	want = `http_response_size_bytes_bucket{method="POST",path="/echo",service="size-service",status_code="200",le="10"} 0`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	want = `http_response_size_bytes_sum{method="GET",path="/stream",service="size-service",status_code="200"} 8`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	if strings.Contains(got, `http_response_size_bytes_count{method="GET",path="/chunked"`) {
+		t.Errorf("chunked responses should not be observed: %s", got)
+	}
+
+	want = `http_request_size_bytes_count{method="POST",path="/echo",service="size-service",status_code="200"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	notWant := `http_request_size_bytes_sum{method="POST",path="/echo",service="size-service",status_code="200"} 11` + "\n"
+	if strings.Contains(got, notWant) {
+		t.Errorf("request size should include the headers: %s", got)
+	}
+}
+
+func TestSizeHistogramsDisabledByDefault(t *testing.T) {
+	t.Parallel()
+
+	app := fiber.New()
+	prometheus := New("size-disabled")
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(prometheus.Middleware)
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("Hello World") })
+
+	app.Test(httptest.NewRequest("GET", "/", nil), -1)
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+
+	if strings.Contains(got, "size_bytes") {
+		t.Errorf("size histograms should be disabled by default: %s", got)
+	}
+}
@@ -0,0 +1,135 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// skipRules are the compiled pattern, method and header skip rules of a
+// Config. They are evaluated against the request before the handler chain
+// runs, so skipped requests don't touch any metric.
+type skipRules struct {
+	prefixes []string
+	globs    []string
+	regexps  []*regexp.Regexp
+	methods  map[string]bool
+	headers  []headerRule
+}
+
+// headerRule matches requests whose header value matches the expression.
+type headerRule struct {
+	name  string
+	value *regexp.Regexp
+}
+
+// newSkipRules compiles the skip rules of the config, returning nil if
+// there are none.
+func newSkipRules(cfg Config) (*skipRules, error) {
+	if len(cfg.SkipPathPrefixes) == 0 && len(cfg.SkipPathGlobs) == 0 && len(cfg.SkipPathRegexps) == 0 &&
+		len(cfg.SkipMethods) == 0 && len(cfg.SkipHeaders) == 0 {
+		return nil, nil
+	}
+
+	rules := &skipRules{
+		prefixes: cfg.SkipPathPrefixes,
+	}
+
+	for _, glob := range cfg.SkipPathGlobs {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("fiberprometheus: invalid skip glob %q: %w", glob, err)
+		}
+		rules.globs = append(rules.globs, glob)
+	}
+
+	for _, expr := range cfg.SkipPathRegexps {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("fiberprometheus: invalid skip regexp %q: %w", expr, err)
+		}
+		rules.regexps = append(rules.regexps, re)
+	}
+
+	if len(cfg.SkipMethods) > 0 {
+		rules.methods = make(map[string]bool, len(cfg.SkipMethods))
+		for _, method := range cfg.SkipMethods {
+			rules.methods[strings.ToUpper(method)] = true
+		}
+	}
+
+	for name, expr := range cfg.SkipHeaders {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("fiberprometheus: invalid skip header regexp %q for %q: %w", expr, name, err)
+		}
+		rules.headers = append(rules.headers, headerRule{name: name, value: re})
+	}
+
+	return rules, nil
+}
+
+// match reports whether the request should not be recorded.
+func (r *skipRules) match(ctx *fiber.Ctx) bool {
+	if r.methods[ctx.Method()] {
+		return true
+	}
+
+	for _, h := range r.headers {
+		if value := ctx.Request().Header.Peek(h.name); value != nil && h.value.Match(value) {
+			return true
+		}
+	}
+
+	return r.matchPath(normalizePath(ctx.Path()))
+}
+
+// matchRoute reports whether requests to the route would not be recorded
+// by the method and path rules. Header rules are not evaluated.
+func (r *skipRules) matchRoute(method, p string) bool {
+	return r.methods[method] || r.matchPath(p)
+}
+
+// matchPath reports whether the normalized path matches a path rule.
+func (r *skipRules) matchPath(p string) bool {
+	for _, prefix := range r.prefixes {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	for _, glob := range r.globs {
+		if ok, _ := path.Match(glob, p); ok {
+			return true
+		}
+	}
+	for _, re := range r.regexps {
+		if re.MatchString(p) {
+			return true
+		}
+	}
+
+	return false
+}
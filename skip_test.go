@@ -0,0 +1,130 @@
+//
+// Copyright (c) 2021-present Ankur Srivastava and Contributors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package fiberprometheus
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSkipRules(t *testing.T) {
+	t.Parallel()
+
+	app := fiber.New()
+	prometheus, err := NewWithConfig(Config{
+		ServiceName:      "skip-rules",
+		Namespace:        "http",
+		SkipPathPrefixes: []string{"/static/"},
+		SkipPathGlobs:    []string{"/health/*"},
+		SkipPathRegexps:  []string{`^/debug/pprof(/|$)`},
+		SkipMethods:      []string{"options"},
+		SkipHeaders:      map[string]string{"User-Agent": "^ELB-HealthChecker/"},
+	})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+	prometheus.RegisterAt(app, "/metrics")
+	app.Use(prometheus.Middleware)
+
+	handler := func(c *fiber.Ctx) error { return c.SendString("OK") }
+	app.Get("/", handler)
+	app.Options("/", handler)
+	app.Get("/static/*", handler)
+	app.Get("/health/live", handler)
+	app.Get("/health/ready/deep", handler)
+	app.Get("/debug/pprof", handler)
+
+	for _, path := range []string{"/static/css/app.css", "/health/live", "/health/ready/deep", "/debug/pprof"} {
+		app.Test(httptest.NewRequest("GET", path, nil), -1)
+	}
+	app.Test(httptest.NewRequest("OPTIONS", "/", nil), -1)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("User-Agent", "ELB-HealthChecker/2.0")
+	app.Test(req, -1)
+
+	app.Test(httptest.NewRequest("GET", "/", nil), -1)
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/metrics", nil), -1)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	got := string(body)
+
+	want := `http_requests_total{method="GET",path="/",service="skip-rules",status_code="200"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+
+	for _, notWant := range []string{`path="/static/*"`, `path="/health/live"`, `path="/debug/pprof"`, `method="OPTIONS"`} {
+		if strings.Contains(got, notWant) {
+			t.Errorf("metrics should skip %s: %s", notWant, got)
+		}
+	}
+
+	// The glob does not cross path segments
+	want = `http_requests_total{method="GET",path="/health/ready/deep",service="skip-rules",status_code="200"} 1`
+	if !strings.Contains(got, want) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
+
+func TestSkipPathsKeepsHandlerError(t *testing.T) {
+	t.Parallel()
+
+	app := fiber.New()
+	prometheus, err := NewWithConfig(Config{SkipPaths: []string{"/teapot"}})
+	if err != nil {
+		t.Fatalf("NewWithConfig: %v", err)
+	}
+	app.Use(prometheus.Middleware)
+	app.Get("/teapot", func(c *fiber.Ctx) error { return fiber.ErrTeapot })
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/teapot", nil), -1)
+	if resp.StatusCode != fiber.StatusTeapot {
+		t.Errorf("Expected status 418, got %d", resp.StatusCode)
+	}
+}
+
+func TestSkipRulesValidation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "invalid glob", cfg: Config{SkipPathGlobs: []string{"/health/["}}},
+		{name: "invalid regexp", cfg: Config{SkipPathRegexps: []string{"(unclosed"}}},
+		{name: "invalid header regexp", cfg: Config{SkipHeaders: map[string]string{"User-Agent": "(unclosed"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWithConfig(tt.cfg); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}